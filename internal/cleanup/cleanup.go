@@ -0,0 +1,160 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+)
+
+// ErrAlreadyDeleted is returned by Cancel when the worker removed an object
+// before its upload could be committed.
+var ErrAlreadyDeleted = errors.New("cleanup: object already deleted")
+
+// maxBackoff caps the delay between retries of a failing delete.
+const maxBackoff = time.Hour
+
+// batchSize is how many deletions the worker claims at a time.
+const batchSize = 100
+
+// Config tunes the cleanup worker.
+type Config struct {
+	// Interval between polls of the outbox.
+	Interval time.Duration
+}
+
+// ConfigFromEnv reads the worker configuration from environment variables.
+func ConfigFromEnv() Config {
+	cfg := Config{Interval: 10 * time.Second}
+	if interval, err := time.ParseDuration(os.Getenv("CLEANUP_INTERVAL")); err == nil && interval > 0 {
+		cfg.Interval = interval
+	}
+	return cfg
+}
+
+// Enqueue schedules keys for deletion at due. Call it with the transaction
+// that stops referencing the objects so both commit or neither does.
+func Enqueue(tx *gorm.DB, keys []string, due time.Time) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	deletions := make([]models.PendingDeletion, len(keys))
+	for i, key := range keys {
+		deletions[i] = models.PendingDeletion{StorageKey: key, NextAttemptAt: due}
+	}
+	return tx.Create(&deletions).Error
+}
+
+// Expedite makes the pending deletions of keys due right away, for uploads
+// known to be abandoned.
+func Expedite(db *gorm.DB, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return db.Model(&models.PendingDeletion{}).
+		Where("storage_key IN ?", keys).
+		Update("next_attempt_at", time.Now()).Error
+}
+
+// Cancel drops the pending deletions of keys, which have become referenced.
+// It fails with ErrAlreadyDeleted if any of them was processed already.
+func Cancel(tx *gorm.DB, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	result := tx.Where("storage_key IN ?", keys).Delete(&models.PendingDeletion{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < int64(len(keys)) {
+		return ErrAlreadyDeleted
+	}
+	return nil
+}
+
+// Worker deletes the objects queued in the outbox, retrying failures with
+// exponential backoff.
+type Worker struct {
+	db    *gorm.DB
+	store storage.Storage
+	cfg   Config
+}
+
+// NewWorker creates a worker draining the outbox in db.
+func NewWorker(db *gorm.DB, store storage.Storage, cfg Config) *Worker {
+	return &Worker{db: db, store: store, cfg: cfg}
+}
+
+// Run processes due deletions every cfg.Interval until ctx is done.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := w.ProcessDue(ctx); err != nil {
+			log.Println("Cleanup failed:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDue works through every deletion that is due, one batch at a time.
+func (w *Worker) ProcessDue(ctx context.Context) error {
+	for {
+		processed, err := w.processBatch(ctx)
+		if err != nil || processed < batchSize {
+			return err
+		}
+	}
+}
+
+// processBatch claims a batch of due deletions and attempts each. Rows are
+// locked while their object is deleted, so Cancel blocks instead of racing
+// with the delete, and several instances can share the outbox.
+func (w *Worker) processBatch(ctx context.Context) (int, error) {
+	var processed int
+	err := w.db.Transaction(func(tx *gorm.DB) error {
+		var deletions []models.PendingDeletion
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("next_attempt_at <= ?", time.Now()).
+			Order("id").
+			Limit(batchSize).
+			Find(&deletions).Error
+		if err != nil {
+			return err
+		}
+		processed = len(deletions)
+		for _, deletion := range deletions {
+			if err := w.store.Delete(ctx, deletion.StorageKey); err != nil {
+				deletion.Attempts++
+				deletion.LastError = err.Error()
+				deletion.NextAttemptAt = time.Now().Add(backoff(deletion.Attempts))
+				log.Printf("Failed to delete object %q (attempt %d): %v", deletion.StorageKey, deletion.Attempts, err)
+				if err := tx.Save(&deletion).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Delete(&deletion).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return processed, err
+}
+
+// backoff returns the delay before the given retry attempt.
+func backoff(attempts int) time.Duration {
+	delay := time.Second << min(attempts, 12)
+	return min(delay, maxBackoff)
+}
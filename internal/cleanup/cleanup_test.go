@@ -0,0 +1,22 @@
+package cleanup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 2*time.Second, backoff(1))
+	assert.Equal(t, 4*time.Second, backoff(2))
+	assert.Equal(t, maxBackoff, backoff(20))
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("CLEANUP_INTERVAL", "30s")
+	assert.Equal(t, 30*time.Second, ConfigFromEnv().Interval)
+
+	t.Setenv("CLEANUP_INTERVAL", "invalid")
+	assert.Equal(t, 10*time.Second, ConfigFromEnv().Interval)
+}
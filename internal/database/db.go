@@ -1,10 +1,16 @@
 package database
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"regexp"
+	"strings"
+	"time"
 	"todo-app/internal/models"
+	"todo-app/internal/storage"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"github.com/joho/godotenv"
@@ -12,6 +18,10 @@ import (
 
 var DB *gorm.DB
 
+// SearchLanguage is the PostgreSQL text search configuration todos are
+// indexed and searched with, e.g. "english" or "simple".
+var SearchLanguage = "english"
+
 func InitDatabase() {
 	godotenv.Load()
     dsn := fmt.Sprintf(
@@ -22,6 +32,9 @@ func InitDatabase() {
         os.Getenv("DB_NAME"),
         os.Getenv("DB_PORT"),
     )
+    if language := os.Getenv("SEARCH_LANGUAGE"); language != "" {
+        SearchLanguage = language
+    }
 
     var err error
     DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
@@ -32,7 +45,7 @@ func InitDatabase() {
     fmt.Println("Connected to PostgreSQL successfully!")
 
     // Migrate the models
-    if err := DB.AutoMigrate(&models.Todo{}); err != nil {
+    if err := Migrate(DB); err != nil {
         log.Fatal("AutoMigrate error:", err)
     }
 }
@@ -42,5 +55,207 @@ func GetDB() *gorm.DB {
 }
 
 func DBMigrate() {
-	DB.AutoMigrate(&models.Todo{})
+	Migrate(DB)
+}
+
+// Models lists every model the schema holds a table for.
+var Models = []any{&models.Todo{}, &models.Attachment{}, &models.PendingDeletion{}, &models.Blob{}, &models.Upload{}, &models.Thumbnail{}, &models.AttachmentVersion{}, &models.QuarantinedFile{}}
+
+// Migrate brings the schema of db up to date with the models and moves
+// data stored in earlier layouts over.
+func Migrate(db *gorm.DB) error {
+	// Content stored before uploads were scanned was never looked at, like
+	// content stored without a scanner, so it is recorded as skipped.
+	var unscanned []any
+	for _, model := range []any{&models.Attachment{}, &models.AttachmentVersion{}} {
+		if !db.Migrator().HasColumn(model, "scan_status") {
+			unscanned = append(unscanned, model)
+		}
+	}
+	if err := db.AutoMigrate(Models...); err != nil {
+		return err
+	}
+	for _, model := range unscanned {
+		if err := db.Model(model).Where("scan_status = ?", models.ScanUnscanned).Update("scan_status", models.ScanSkipped).Error; err != nil {
+			return err
+		}
+	}
+	if err := migrateLegacyAttachments(db); err != nil {
+		return err
+	}
+	if err := migrateBlobs(db); err != nil {
+		return err
+	}
+	if err := MigrateSearch(db); err != nil {
+		return err
+	}
+	// Attachments used to carry a permanent public URL. Objects are private
+	// now and clients request short-lived URLs instead.
+	if db.Migrator().HasColumn(&models.Attachment{}, "url") {
+		return db.Migrator().DropColumn(&models.Attachment{}, "url")
+	}
+	return nil
+}
+
+// searchVectorColumn is the generated full-text search column of todos. It
+// is left out of the model so GORM never writes to it.
+const searchVectorColumn = "search_vector"
+
+// MigrateSearch adds the full-text search column of todos, built from the
+// title and description with SearchLanguage, along with its GIN index.
+// The column is rebuilt when the language changed since it was added.
+func MigrateSearch(db *gorm.DB) error {
+	if !regexp.MustCompile(`^[a-z_]+$`).MatchString(SearchLanguage) {
+		return fmt.Errorf("invalid search language %q", SearchLanguage)
+	}
+	var found int64
+	if err := db.Raw("SELECT COUNT(*) FROM pg_ts_config WHERE cfgname = ?", SearchLanguage).Scan(&found).Error; err != nil {
+		return err
+	}
+	if found == 0 {
+		return fmt.Errorf("unknown search language %q", SearchLanguage)
+	}
+
+	var expression string
+	err := db.Raw(`
+		SELECT pg_get_expr(d.adbin, d.adrelid)
+		FROM pg_attrdef d
+		JOIN pg_attribute a ON a.attrelid = d.adrelid AND a.attnum = d.adnum
+		WHERE d.adrelid = 'todos'::regclass AND a.attname = ?`, searchVectorColumn).Scan(&expression).Error
+	if err != nil {
+		return err
+	}
+	if strings.Contains(expression, "'"+SearchLanguage+"'::regconfig") {
+		return nil
+	}
+	// The language was checked against pg_ts_config above, so it can go
+	// into the statement as is.
+	return db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			"ALTER TABLE todos DROP COLUMN IF EXISTS " + searchVectorColumn,
+			fmt.Sprintf(`ALTER TABLE todos ADD COLUMN %s tsvector GENERATED ALWAYS AS (
+				setweight(to_tsvector('%[2]s'::regconfig, COALESCE(title, '')), 'A') ||
+				setweight(to_tsvector('%[2]s'::regconfig, COALESCE(description, '')), 'B')
+			) STORED`, searchVectorColumn, SearchLanguage),
+			fmt.Sprintf("CREATE INDEX idx_todos_%[1]s ON todos USING GIN (%[1]s)", searchVectorColumn),
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// migrateLegacyAttachments moves the comma-joined URLs of the old
+// todos.attachment column into the attachments table and drops the column.
+func migrateLegacyAttachments(db *gorm.DB) error {
+	if !db.Migrator().HasColumn("todos", "attachment") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var rows []struct {
+			ID         uint
+			Attachment string
+		}
+		err := tx.Table("todos").
+			Select("id, attachment").
+			Where("attachment IS NOT NULL AND attachment <> ''").
+			Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			for _, url := range strings.Split(row.Attachment, ",") {
+				url = strings.TrimSpace(url)
+				if url == "" {
+					continue
+				}
+				// Objects were keyed by their bare filename, which is the
+				// last segment of the URL.
+				key := url[strings.LastIndex(url, "/")+1:]
+				attachment := models.Attachment{
+					TodoID:           row.ID,
+					StorageKey:       key,
+					OriginalFilename: key,
+					UploadedAt:       time.Now(),
+				}
+				if err := tx.Create(&attachment).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Migrator().DropColumn("todos", "attachment")
+	})
+}
+
+// migrateBlobs creates blobs for content stored before it was
+// deduplicated. Each checksum adopts the object of its oldest attachment,
+// or of its oldest version when no attachment has it any more; the other
+// copies stay private to their rows and are deleted with them. Both
+// attachments and their versions count as references.
+func migrateBlobs(db *gorm.DB) error {
+	return db.Exec(`
+		WITH contents AS (
+			SELECT 0 AS source, id, checksum, storage_key, size FROM attachments
+			UNION ALL
+			SELECT 1 AS source, id, checksum, storage_key, size FROM attachment_versions
+		)
+		INSERT INTO blobs (checksum, storage_key, size, ref_count, created_at)
+		SELECT DISTINCT ON (c.checksum) c.checksum, c.storage_key, c.size,
+			(SELECT COUNT(*) FROM contents r WHERE r.storage_key = c.storage_key), NOW()
+		FROM contents c
+		WHERE c.checksum <> '' AND NOT EXISTS (SELECT 1 FROM blobs WHERE blobs.checksum = c.checksum)
+		ORDER BY c.checksum, c.source, c.id`).Error
+}
+
+// MigrateAttachmentKeys moves objects that were stored under their bare
+// client filename to namespaced keys (todos/<id>/<uuid>/<name>), so new
+// uploads can no longer overwrite them. Resumable uploads are namespaced
+// below uploads/ from the start.
+func MigrateAttachmentKeys(ctx context.Context, store storage.Storage) error {
+	var attachments []models.Attachment
+	if err := DB.Where("storage_key NOT LIKE ? AND storage_key NOT LIKE ?", "todos/%", "uploads/%").Find(&attachments).Error; err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		oldKey := attachment.StorageKey
+		newKey := storage.NewKey(fmt.Sprintf("todos/%d", attachment.TodoID), attachment.OriginalFilename)
+
+		body, info, err := store.Get(ctx, oldKey)
+		if errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Skipping attachment %d: object %q is missing", attachment.ID, oldKey)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = store.Put(ctx, newKey, body, storage.PutOptions{
+			ContentType:        attachment.ContentType,
+			Size:               info.Size,
+			ContentDisposition: storage.ContentDisposition("attachment", attachment.OriginalFilename),
+		})
+		body.Close()
+		if err != nil {
+			return err
+		}
+		if err := DB.Model(&attachment).Update("storage_key", newKey).Error; err != nil {
+			store.Delete(ctx, newKey)
+			return err
+		}
+
+		// Several todos may have shared one bare key; keep the object until
+		// the last of them has moved.
+		var remaining int64
+		if err := DB.Model(&models.Attachment{}).Where("storage_key = ?", oldKey).Count(&remaining).Error; err != nil {
+			return err
+		}
+		if remaining == 0 {
+			if err := store.Delete(ctx, oldKey); err != nil {
+				log.Printf("Failed to delete migrated object %q: %v", oldKey, err)
+			}
+		}
+	}
+	return nil
 }
\ No newline at end of file
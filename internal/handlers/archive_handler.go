@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+)
+
+// manifestName is the archive entry describing the todo.
+const manifestName = "manifest.json"
+
+// archiveManifest describes the todo an archive was built from and what
+// became of each of its attachments.
+type archiveManifest struct {
+	ID          uint          `json:"id"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Owner       string        `json:"owner"`
+	Completed   bool          `json:"completed"`
+	CompletedAt *time.Time    `json:"completed_at"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+	GeneratedAt time.Time     `json:"generated_at"`
+	Files       []archiveFile `json:"files"`
+}
+
+// archiveFile is an attachment as listed in the manifest. Name is where it
+// is found in the archive; attachments left out have Skipped set instead.
+type archiveFile struct {
+	AttachmentID     uint      `json:"attachment_id"`
+	Name             string    `json:"name,omitempty"`
+	OriginalFilename string    `json:"original_filename"`
+	Size             int64     `json:"size"`
+	ContentType      string    `json:"content_type"`
+	Checksum         string    `json:"checksum"`
+	Version          int       `json:"version"`
+	UploadedAt       time.Time `json:"uploaded_at"`
+	ScanStatus       string    `json:"scan_status"`
+	Skipped          string    `json:"skipped,omitempty"`
+}
+
+// GetAttachmentsArchive streams every attachment of a todo as a ZIP
+// archive, starting with a manifest describing the todo. The archive is
+// built while it is sent, one object at a time, so memory use does not
+// depend on the size of the attachments. Only clean content is included;
+// the manifest notes what was left out.
+//
+//	@Summary	Download all attachments of a todo as a ZIP archive
+//	@Tags		attachments
+//	@Produce	application/zip
+//	@Param		id			path		int		true	"Todo ID"
+//	@Param		X-Owner-ID	header		string	false	"Owner of the todo"
+//	@Success	200			{file}		file
+//	@Failure	400			{object}	errorResponse
+//	@Failure	403			{object}	errorResponse
+//	@Failure	404			{object}	errorResponse
+//	@Router		/todos/{id}/attachments.zip [get]
+func GetAttachmentsArchive(c *gin.Context, db *gorm.DB, store storage.Storage) {
+	todo, ok := findOwnedTodo(c)
+	if !ok {
+		return
+	}
+	var attachments []models.Attachment
+	if err := database.DB.Where("todo_id = ?", todo.ID).Order("id").Find(&attachments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load attachments"})
+		return
+	}
+
+	manifest := archiveManifest{
+		ID:          todo.ID,
+		Title:       todo.Title,
+		Description: todo.Description,
+		Owner:       todo.Owner,
+		Completed:   todo.Completed,
+		CompletedAt: todo.CompletedAt,
+		CreatedAt:   todo.CreatedAt,
+		UpdatedAt:   todo.UpdatedAt,
+		GeneratedAt: time.Now(),
+		Files:       make([]archiveFile, len(attachments)),
+	}
+	taken := map[string]bool{manifestName: true}
+	for i, attachment := range attachments {
+		file := archiveFile{
+			AttachmentID:     attachment.ID,
+			OriginalFilename: attachment.OriginalFilename,
+			Size:             attachment.Size,
+			ContentType:      attachment.ContentType,
+			Checksum:         attachment.Checksum,
+			Version:          attachment.Version,
+			UploadedAt:       attachment.UploadedAt,
+			ScanStatus:       attachment.ScanStatus,
+		}
+		switch {
+		case servable(attachment.ScanStatus):
+			file.Name = archiveName(attachment.OriginalFilename, taken)
+		case attachment.ScanStatus == models.ScanInfected:
+			file.Skipped = "malware_detected"
+		default:
+			file.Skipped = "not_scanned"
+		}
+		manifest.Files[i] = file
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "application/zip")
+	header.Set("Content-Disposition", storage.ContentDisposition("attachment", fmt.Sprintf("todo-%d.zip", todo.ID)))
+	header.Set("Cache-Control", "private, no-cache")
+	header.Set("X-Content-Type-Options", "nosniff")
+	c.Status(http.StatusOK)
+
+	// Once streaming started the status can't change anymore. Should an
+	// object fail to load, the archive is cut short without its central
+	// directory, which unzip tools report as a broken download.
+	archive := zip.NewWriter(c.Writer)
+	if err := writeManifest(archive, manifest); err != nil {
+		log.Printf("Failed to archive todo %d: %v", todo.ID, err)
+		return
+	}
+	for i, attachment := range attachments {
+		file := manifest.Files[i]
+		if file.Name == "" {
+			continue
+		}
+		if err := writeArchiveFile(c, archive, store, attachment, file.Name); err != nil {
+			log.Printf("Failed to archive attachment %d of todo %d: %v", attachment.ID, todo.ID, err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("Failed to archive todo %d: %v", todo.ID, err)
+	}
+}
+
+// writeManifest adds the manifest as the first entry of the archive.
+func writeManifest(archive *zip.Writer, manifest archiveManifest) error {
+	w, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     manifestName,
+		Method:   zip.Deflate,
+		Modified: manifest.GeneratedAt,
+	})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(manifest)
+}
+
+// writeArchiveFile copies the content of attachment into the archive under
+// name.
+func writeArchiveFile(c *gin.Context, archive *zip.Writer, store storage.Storage, attachment models.Attachment, name string) error {
+	body, _, err := store.Get(c.Request.Context(), attachment.StorageKey)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	w, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: attachment.UploadedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, body)
+	return err
+}
+
+// archiveName picks the name of a file inside an archive: its filename
+// without directories, numbered like "report (2).pdf" when already taken.
+// Names compare case-insensitively, as they would once extracted on most
+// desktops.
+func archiveName(filename string, taken map[string]bool) string {
+	filename = filename[strings.LastIndexAny(filename, `/\`)+1:]
+	if filename == "" || filename == "." || filename == ".." {
+		filename = "attachment"
+	}
+	name := filename
+	ext := path.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	if base == "" {
+		base, ext = filename, ""
+	}
+	for n := 2; taken[strings.ToLower(name)]; n++ {
+		name = base + " (" + strconv.Itoa(n) + ")" + ext
+	}
+	taken[strings.ToLower(name)] = true
+	return name
+}
@@ -0,0 +1,118 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/handlers"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAttachmentContent(t *testing.T) {
+	// Setup Gin router and database
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Use real database for test
+	db := setupTestDB()
+	database.DB = db
+	store := storage.NewMemory()
+
+	router.GET("/todos/:id/attachments/:attachmentId/content", func(c *gin.Context) {
+		handlers.GetAttachmentContent(c, db, store)
+	})
+
+	// Insert a todo with one stored attachment
+	store.Put(context.Background(), "todos/1/report.txt", strings.NewReader("hello world"), storage.PutOptions{})
+	todo := models.Todo{
+		Title: "Test Todo",
+		Attachments: []models.Attachment{{
+			StorageKey:       "todos/1/report.txt",
+			OriginalFilename: "report.txt",
+			ContentType:      "text/plain; charset=utf-8",
+			Size:             11,
+			Checksum:         "abc123",
+			ScanStatus:       models.ScanClean,
+		}},
+	}
+	db.Create(&todo)
+	contentPath := "/todos/" + strconv.Itoa(int(todo.ID)) + "/attachments/" + strconv.Itoa(int(todo.Attachments[0].ID)) + "/content"
+
+	t.Run("Download the whole attachment", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", contentPath, nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "hello world", resp.Body.String())
+		assert.Equal(t, `"abc123"`, resp.Header().Get("ETag"))
+		assert.Equal(t, `inline; filename=report.txt`, resp.Header().Get("Content-Disposition"))
+	})
+
+	t.Run("Download a range", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", contentPath+"?download=true", nil)
+		req.Header.Set("Range", "bytes=6-")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusPartialContent, resp.Code)
+		assert.Equal(t, "world", resp.Body.String())
+		assert.Equal(t, "bytes 6-10/11", resp.Header().Get("Content-Range"))
+		assert.Equal(t, `attachment; filename=report.txt`, resp.Header().Get("Content-Disposition"))
+	})
+
+	t.Run("Not modified when the ETag matches", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", contentPath, nil)
+		req.Header.Set("If-None-Match", `"abc123"`)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusNotModified, resp.Code)
+		assert.Empty(t, resp.Body.String())
+	})
+
+	t.Run("Deny access to another owner's attachment", func(t *testing.T) {
+		db.Model(&todo).Update("owner", "alice")
+
+		req, _ := http.NewRequest("GET", contentPath, nil)
+		req.Header.Set("X-Owner-ID", "bob")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+
+		req.Header.Set("X-Owner-ID", "alice")
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+
+	t.Run("Refuse content that is not clean", func(t *testing.T) {
+		attachment := todo.Attachments[0]
+		for status, code := range map[string]string{
+			models.ScanUnscanned: "not_scanned",
+			models.ScanInfected:  "malware_detected",
+		} {
+			db.Model(&attachment).Update("scan_status", status)
+
+			req, _ := http.NewRequest("GET", contentPath, nil)
+			req.Header.Set("X-Owner-ID", "alice")
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+			assert.Equal(t, http.StatusForbidden, resp.Code)
+			var response map[string]string
+			json.Unmarshal(resp.Body.Bytes(), &response)
+			assert.Equal(t, code, response["code"])
+		}
+	})
+
+	truncateTable(db)
+}
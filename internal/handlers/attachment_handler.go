@@ -0,0 +1,680 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+)
+
+// GetAttachments lists the attachments of a todo.
+//
+//	@Summary	List the attachments of a todo
+//	@Tags		attachments
+//	@Produce	json
+//	@Param		id			path		int		true	"Todo ID"
+//	@Param		X-Owner-ID	header		string	false	"Owner of the todo"
+//	@Success	200			{array}		models.Attachment
+//	@Failure	400			{object}	errorResponse
+//	@Failure	403			{object}	errorResponse
+//	@Failure	404			{object}	errorResponse
+//	@Router		/todos/{id}/attachments [get]
+func GetAttachments(c *gin.Context, db *gorm.DB) {
+	todo, ok := findOwnedTodo(c)
+	if !ok {
+		return
+	}
+	attachments := []models.Attachment{}
+	if err := database.DB.Preload("Thumbnails").Where("todo_id = ?", todo.ID).Order("id").Find(&attachments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load attachments"})
+		return
+	}
+	c.JSON(http.StatusOK, attachments)
+}
+
+// AddAttachments uploads the "files" of a multipart request and appends them
+// to a todo, leaving its other attachments alone. Files named like an
+// existing attachment become its new version.
+//
+//	@Summary	Add attachments to a todo
+//	@Tags		attachments
+//	@Accept		mpfd
+//	@Produce	json
+//	@Param		id			path		int		true	"Todo ID"
+//	@Param		X-Owner-ID	header		string	false	"Owner of the todo"
+//	@Param		files		formData	file	true	"Files to attach"
+//	@Success	201			{array}		models.Attachment
+//	@Failure	400			{object}	errorResponse
+//	@Failure	403			{object}	errorResponse
+//	@Failure	404			{object}	errorResponse
+//	@Failure	413			{object}	errorResponse
+//	@Failure	415			{object}	errorResponse
+//	@Failure	422			{object}	errorResponse
+//	@Failure	503			{object}	errorResponse
+//	@Router		/todos/{id}/attachments [post]
+func AddAttachments(c *gin.Context, db *gorm.DB, store storage.Storage) {
+	todo, ok := findOwnedTodo(c)
+	if !ok {
+		return
+	}
+	var existing []models.Attachment
+	if err := database.DB.Where("todo_id = ?", todo.ID).Find(&existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add attachments"})
+		return
+	}
+	budget, err := newUploadBudget(todo.Owner, attachmentsSize(existing), 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add attachments"})
+		return
+	}
+	form, err := readTodoForm(c, store, todo.ID, budget)
+	if err != nil {
+		respondError(c, err, "Failed to add attachments")
+		return
+	}
+	if len(form.Attachments) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No files provided"})
+		return
+	}
+	uploaded := attachmentKeys(form.Attachments)
+	var saved []models.Attachment
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := commitUploads(tx, form.Attachments); err != nil {
+			return err
+		}
+		if saved, err = saveAttachments(tx, todo.ID, form.Attachments); err != nil {
+			return err
+		}
+		return touchTodo(tx, todo.ID)
+	})
+	if err != nil {
+		abandonUploads(uploaded)
+		respondError(c, err, "Failed to add attachments")
+		return
+	}
+	c.JSON(http.StatusCreated, saved)
+}
+
+// DeleteAttachment removes a single attachment and its stored object.
+//
+//	@Summary	Delete an attachment
+//	@Tags		attachments
+//	@Produce	json
+//	@Param		id				path		int		true	"Todo ID"
+//	@Param		attachmentId	path		int		true	"Attachment ID"
+//	@Param		X-Owner-ID		header		string	false	"Owner of the todo"
+//	@Success	200				{object}	map[string]string
+//	@Failure	400				{object}	errorResponse
+//	@Failure	403				{object}	errorResponse
+//	@Failure	404				{object}	errorResponse
+//	@Router		/todos/{id}/attachments/{attachmentId} [delete]
+func DeleteAttachment(c *gin.Context, db *gorm.DB, store storage.Storage) {
+	if _, ok := findOwnedTodo(c); !ok {
+		return
+	}
+	attachment, ok := findAttachment(c)
+	if !ok {
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := releaseAttachments(tx, []models.Attachment{attachment}); err != nil {
+			return err
+		}
+		if err := tx.Delete(&attachment).Error; err != nil {
+			return err
+		}
+		return touchTodo(tx, attachment.TodoID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attachment"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted"})
+}
+
+// attachmentURLResponse is the body of GetAttachmentURL, for the API docs.
+type attachmentURLResponse struct {
+	URL       string     `json:"url" example:"/todos/1/attachments/2/content?download=true"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// GetAttachmentURL hands out a short-lived download URL for one attachment.
+// When storage cannot presign expiring URLs, as with local, in-memory or
+// encrypted storage, it points at the content route instead. That URL does
+// not expire, so the response carries no expires_at then.
+//
+//	@Summary	Get a download URL for an attachment
+//	@Tags		attachments
+//	@Produce	json
+//	@Param		id				path		int		true	"Todo ID"
+//	@Param		attachmentId	path		int		true	"Attachment ID"
+//	@Param		X-Owner-ID		header		string	false	"Owner of the todo"
+//	@Success	200				{object}	attachmentURLResponse
+//	@Failure	400				{object}	errorResponse
+//	@Failure	403				{object}	errorResponse
+//	@Failure	404				{object}	errorResponse
+//	@Router		/todos/{id}/attachments/{attachmentId}/url [get]
+func GetAttachmentURL(c *gin.Context, db *gorm.DB, store storage.Storage) {
+	if _, ok := findOwnedTodo(c); !ok {
+		return
+	}
+	attachment, ok := findAttachment(c)
+	if !ok || !checkServable(c, attachment.ScanStatus) {
+		return
+	}
+	expiresAt := time.Now().Add(attachmentURLTTL)
+	// Deduplicated objects are shared, so the filename comes from the
+	// attachment rather than the object's stored metadata.
+	disposition := storage.ContentDisposition("attachment", attachment.OriginalFilename)
+	url, err := store.PresignGet(c.Request.Context(), attachment.StorageKey, attachmentURLTTL, disposition)
+	if errors.Is(err, storage.ErrPresignUnsupported) {
+		url := strings.TrimSuffix(c.Request.URL.Path, "/url") + "/content?download=true"
+		c.JSON(http.StatusOK, gin.H{"url": url})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate attachment URL"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"url": url, "expires_at": expiresAt})
+}
+
+// GetAttachmentContent streams an attachment through the API. Range,
+// If-Range, If-None-Match and If-Modified-Since are honoured, so browsers
+// can preview files and resume downloads without the bucket being public.
+// Pass ?download=true to have the browser save the file instead of showing
+// it.
+//
+//	@Summary	Download an attachment
+//	@Tags		attachments
+//	@Produce	octet-stream
+//	@Param		id					path		int		true	"Todo ID"
+//	@Param		attachmentId		path		int		true	"Attachment ID"
+//	@Param		X-Owner-ID			header		string	false	"Owner of the todo"
+//	@Param		download			query		bool	false	"Have the browser save the file instead of showing it"
+//	@Param		Range				header		string	false	"Byte range to send"
+//	@Param		If-Range			header		string	false	"ETag or date the range depends on"
+//	@Param		If-None-Match		header		string	false	"ETag of the copy at hand"
+//	@Param		If-Modified-Since	header		string	false	"Date of the copy at hand"
+//	@Success	200					{file}		file
+//	@Header		200					{string}	ETag	"Checksum of the content"
+//	@Success	206					{file}		file
+//	@Success	304
+//	@Failure	400					{object}	errorResponse
+//	@Failure	403					{object}	errorResponse
+//	@Failure	404					{object}	errorResponse
+//	@Failure	416
+//	@Router		/todos/{id}/attachments/{attachmentId}/content [get]
+//	@Router		/todos/{id}/attachments/{attachmentId}/content [head]
+func GetAttachmentContent(c *gin.Context, db *gorm.DB, store storage.Storage) {
+	if _, ok := findOwnedTodo(c); !ok {
+		return
+	}
+	attachment, ok := findAttachment(c)
+	if !ok || !checkServable(c, attachment.ScanStatus) {
+		return
+	}
+	disposition := "inline"
+	if download, _ := strconv.ParseBool(c.Query("download")); download {
+		disposition = "attachment"
+	}
+	serveObject(c, store, attachment.StorageKey, attachment.ContentType,
+		storage.ContentDisposition(disposition, attachment.OriginalFilename), attachment.Checksum)
+}
+
+// GetAttachmentThumbnail serves the thumbnail of an image attachment that
+// was scaled to the :size param.
+//
+//	@Summary	Get a thumbnail of an image attachment
+//	@Tags		attachments
+//	@Produce	jpeg,png
+//	@Param		id					path		int		true	"Todo ID"
+//	@Param		attachmentId		path		int		true	"Attachment ID"
+//	@Param		size				path		int		true	"Longest edge in pixels, one of THUMBNAIL_SIZES"
+//	@Param		X-Owner-ID			header		string	false	"Owner of the todo"
+//	@Param		If-None-Match		header		string	false	"ETag of the copy at hand"
+//	@Param		If-Modified-Since	header		string	false	"Date of the copy at hand"
+//	@Success	200					{file}		file
+//	@Success	304
+//	@Failure	400					{object}	errorResponse
+//	@Failure	403					{object}	errorResponse
+//	@Failure	404					{object}	errorResponse
+//	@Router		/todos/{id}/attachments/{attachmentId}/thumbnails/{size} [get]
+func GetAttachmentThumbnail(c *gin.Context, db *gorm.DB, store storage.Storage) {
+	if _, ok := findOwnedTodo(c); !ok {
+		return
+	}
+	attachment, ok := findAttachment(c)
+	if !ok || !checkServable(c, attachment.ScanStatus) {
+		return
+	}
+	size, err := strconv.Atoi(c.Param("size"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid thumbnail size"})
+		return
+	}
+	var thumbnail models.Thumbnail
+	if err := database.DB.Where("attachment_id = ? AND size = ?", attachment.ID, size).First(&thumbnail).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Thumbnail not found"})
+		return
+	}
+	filename := strings.TrimSuffix(attachment.OriginalFilename, path.Ext(attachment.OriginalFilename)) +
+		"-" + strconv.Itoa(size) + path.Ext(thumbnail.StorageKey)
+	serveObject(c, store, thumbnail.StorageKey, thumbnail.ContentType, storage.ContentDisposition("inline", filename), "")
+}
+
+// serveObject streams a stored object, answering Range and conditional
+// requests. The checksum, when known, makes for a stable ETag.
+func serveObject(c *gin.Context, store storage.Storage, key string, contentType string, disposition string, checksum string) {
+	info, err := store.Stat(c.Request.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment content not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load attachment"})
+		return
+	}
+
+	etag := info.ETag
+	if checksum != "" {
+		etag = `"` + checksum + `"`
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Disposition", disposition)
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", "private, no-cache")
+	// Uploaded content must never run as part of the API's origin.
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Content-Security-Policy", "sandbox")
+
+	reader := storage.NewObjectReader(c.Request.Context(), store, key, info.Size)
+	defer reader.Close()
+	http.ServeContent(c.Writer, c.Request, "", info.LastModified, reader)
+}
+
+// GetAttachmentVersions lists the prior versions of an attachment, newest
+// first.
+//
+//	@Summary	List the prior versions of an attachment
+//	@Tags		attachments
+//	@Produce	json
+//	@Param		id				path		int		true	"Todo ID"
+//	@Param		attachmentId	path		int		true	"Attachment ID"
+//	@Param		X-Owner-ID		header		string	false	"Owner of the todo"
+//	@Success	200				{array}		models.AttachmentVersion
+//	@Failure	400				{object}	errorResponse
+//	@Failure	403				{object}	errorResponse
+//	@Failure	404				{object}	errorResponse
+//	@Router		/todos/{id}/attachments/{attachmentId}/versions [get]
+func GetAttachmentVersions(c *gin.Context, db *gorm.DB) {
+	if _, ok := findOwnedTodo(c); !ok {
+		return
+	}
+	attachment, ok := findAttachment(c)
+	if !ok {
+		return
+	}
+	versions := []models.AttachmentVersion{}
+	if err := database.DB.Where("attachment_id = ?", attachment.ID).Order("version DESC").Find(&versions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load versions"})
+		return
+	}
+	c.JSON(http.StatusOK, versions)
+}
+
+// GetAttachmentVersionContent streams a prior version of an attachment like
+// GetAttachmentContent does the current one.
+//
+//	@Summary	Download a prior version of an attachment
+//	@Tags		attachments
+//	@Produce	octet-stream
+//	@Param		id					path		int		true	"Todo ID"
+//	@Param		attachmentId		path		int		true	"Attachment ID"
+//	@Param		version				path		int		true	"Version number"
+//	@Param		X-Owner-ID			header		string	false	"Owner of the todo"
+//	@Param		download			query		bool	false	"Have the browser save the file instead of showing it"
+//	@Param		Range				header		string	false	"Byte range to send"
+//	@Param		If-Range			header		string	false	"ETag or date the range depends on"
+//	@Param		If-None-Match		header		string	false	"ETag of the copy at hand"
+//	@Param		If-Modified-Since	header		string	false	"Date of the copy at hand"
+//	@Success	200					{file}		file
+//	@Header		200					{string}	ETag	"Checksum of the content"
+//	@Success	206					{file}		file
+//	@Success	304
+//	@Failure	400					{object}	errorResponse
+//	@Failure	403					{object}	errorResponse
+//	@Failure	404					{object}	errorResponse
+//	@Failure	416
+//	@Router		/todos/{id}/attachments/{attachmentId}/versions/{version}/content [get]
+func GetAttachmentVersionContent(c *gin.Context, db *gorm.DB, store storage.Storage) {
+	if _, ok := findOwnedTodo(c); !ok {
+		return
+	}
+	attachment, ok := findAttachment(c)
+	if !ok {
+		return
+	}
+	version, ok := findVersion(c, database.DB, attachment)
+	if !ok || !checkServable(c, version.ScanStatus) {
+		return
+	}
+	disposition := "inline"
+	if download, _ := strconv.ParseBool(c.Query("download")); download {
+		disposition = "attachment"
+	}
+	serveObject(c, store, version.StorageKey, version.ContentType,
+		storage.ContentDisposition(disposition, attachment.OriginalFilename), version.Checksum)
+}
+
+// RestoreAttachmentVersion makes a prior version the current content of an
+// attachment again, under a new version number. The content it replaces
+// joins the history in turn.
+//
+//	@Summary	Restore a prior version of an attachment
+//	@Tags		attachments
+//	@Produce	json
+//	@Param		id				path		int		true	"Todo ID"
+//	@Param		attachmentId	path		int		true	"Attachment ID"
+//	@Param		version			path		int		true	"Version number"
+//	@Param		X-Owner-ID		header		string	false	"Owner of the todo"
+//	@Success	200				{object}	models.Attachment
+//	@Failure	400				{object}	errorResponse
+//	@Failure	403				{object}	errorResponse
+//	@Failure	404				{object}	errorResponse
+//	@Router		/todos/{id}/attachments/{attachmentId}/versions/{version}/restore [post]
+func RestoreAttachmentVersion(c *gin.Context, db *gorm.DB) {
+	if _, ok := findOwnedTodo(c); !ok {
+		return
+	}
+	attachment, ok := findAttachment(c)
+	if !ok {
+		return
+	}
+	found := true
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&attachment, attachment.ID).Error; err != nil {
+			return err
+		}
+		var version models.AttachmentVersion
+		if version, found = findVersion(c, tx, attachment); !found {
+			return nil
+		}
+		// The version's reference to its content moves to the attachment.
+		if err := tx.Delete(&version).Error; err != nil {
+			return err
+		}
+		if err := setContent(tx, &attachment, versionContents([]models.AttachmentVersion{version})[0]); err != nil {
+			return err
+		}
+		return touchTodo(tx, attachment.TodoID)
+	})
+	if !found {
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Deleted since findAttachment.
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore version"})
+		return
+	}
+	c.JSON(http.StatusOK, attachment)
+}
+
+// findVersion loads the prior version of attachment named by the :version
+// param. It writes the error response itself and reports whether the
+// caller should carry on.
+func findVersion(c *gin.Context, tx *gorm.DB, attachment models.Attachment) (models.AttachmentVersion, bool) {
+	var version models.AttachmentVersion
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version format"})
+		return version, false
+	}
+	if err := tx.Where("attachment_id = ? AND version = ?", attachment.ID, number).First(&version).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return version, false
+	}
+	return version, true
+}
+
+// checksumsRequest is the JSON body of CheckChecksums.
+type checksumsRequest struct {
+	Checksums []string `json:"checksums" binding:"required"`
+}
+
+// attachByChecksumRequest is the JSON body of AttachByChecksum.
+type attachByChecksumRequest struct {
+	Checksum string `json:"checksum" binding:"required"`
+	Filename string `json:"filename" binding:"required" example:"report.pdf"`
+}
+
+// CheckChecksums tells a client which of the SHA-256 checksums it is about
+// to upload the server already stores, so those files can be attached with
+// AttachByChecksum instead of being sent again. Only content the owner
+// already references is reported, so nothing leaks between owners.
+//
+//	@Summary	Check which checksums are stored already
+//	@Tags		attachments
+//	@Accept		json
+//	@Produce	json
+//	@Param		X-Owner-ID	header		string				false	"Owner whose content to look at"
+//	@Param		checksums	body		checksumsRequest	true	"SHA-256 checksums in hex"
+//	@Success	200			{object}	map[string][]string
+//	@Failure	400			{object}	errorResponse
+//	@Router		/attachments/check [post]
+func CheckChecksums(c *gin.Context, db *gorm.DB) {
+	var request checksumsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	existing := []string{}
+	if len(request.Checksums) > 0 {
+		err := database.DB.Model(&models.Attachment{}).
+			Joins("JOIN todos ON todos.id = attachments.todo_id").
+			Joins("JOIN blobs ON blobs.checksum = attachments.checksum").
+			Where("todos.owner = ? AND attachments.checksum IN ?", c.GetHeader(ownerHeader), normalizeChecksums(request.Checksums)).
+			Distinct().
+			Pluck("attachments.checksum", &existing).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check checksums"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"existing": existing})
+}
+
+// AttachByChecksum attaches content the server already stores to a todo
+// without uploading it again. The same ownership, type and size rules as
+// for uploads apply, and the scan status carries over.
+//
+//	@Summary	Attach stored content by its checksum
+//	@Tags		attachments
+//	@Accept		json
+//	@Produce	json
+//	@Param		id			path		int						true	"Todo ID"
+//	@Param		X-Owner-ID	header		string					false	"Owner of the todo and the content"
+//	@Param		attachment	body		attachByChecksumRequest	true	"Content to attach and its filename"
+//	@Success	201			{object}	models.Attachment
+//	@Failure	400			{object}	errorResponse
+//	@Failure	403			{object}	errorResponse
+//	@Failure	404			{object}	errorResponse
+//	@Failure	413			{object}	errorResponse
+//	@Failure	415			{object}	errorResponse
+//	@Failure	422			{object}	errorResponse
+//	@Router		/todos/{id}/attachments/by-checksum [post]
+func AttachByChecksum(c *gin.Context, db *gorm.DB) {
+	todo, ok := findOwnedTodo(c)
+	if !ok {
+		return
+	}
+	var request attachByChecksumRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	checksum := normalizeChecksums([]string{request.Checksum})[0]
+
+	// The owner has to reference the content already; knowing a checksum
+	// is not enough to get hold of somebody else's file.
+	var source models.Attachment
+	err := database.DB.
+		Joins("JOIN todos ON todos.id = attachments.todo_id").
+		Where("todos.owner = ? AND attachments.checksum = ?", todo.Owner, checksum).
+		First(&source).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Content not found"})
+		return
+	}
+	if source.ScanStatus == models.ScanInfected {
+		respondError(c, malwareError(request.Filename, ""), "Failed to add attachment")
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(source.ContentType)
+	if !contentTypeAllowed(mediaType) {
+		respondError(c, unsupportedTypeError(request.Filename, mediaType), "Failed to add attachment")
+		return
+	}
+	var existing []models.Attachment
+	if err := database.DB.Where("todo_id = ?", todo.ID).Find(&existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add attachment"})
+		return
+	}
+	budget, err := newUploadBudget(todo.Owner, attachmentsSize(existing), 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add attachment"})
+		return
+	}
+	if limit, limitErr := budget.limitFor(request.Filename); source.Size > limit {
+		respondError(c, limitErr, "Failed to add attachment")
+		return
+	}
+
+	attachment := models.Attachment{
+		TodoID:           todo.ID,
+		OriginalFilename: request.Filename,
+		Size:             source.Size,
+		ContentType:      source.ContentType,
+		Checksum:         checksum,
+		UploadedAt:       time.Now(),
+		ScanStatus:       source.ScanStatus,
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var blob models.Blob
+		if err := lockBlob(tx, checksum, &blob); err != nil {
+			return err
+		}
+		blob.RefCount++
+		if err := tx.Save(&blob).Error; err != nil {
+			return err
+		}
+		attachment.StorageKey = blob.StorageKey
+		saved, err := saveAttachments(tx, todo.ID, []models.Attachment{attachment})
+		if err != nil {
+			return err
+		}
+		attachment = saved[0]
+		return touchTodo(tx, todo.ID)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Content not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add attachment"})
+		return
+	}
+	c.JSON(http.StatusCreated, attachment)
+}
+
+// normalizeChecksums lowercases hex checksums the way they are stored.
+func normalizeChecksums(checksums []string) []string {
+	normalized := make([]string, len(checksums))
+	for i, checksum := range checksums {
+		normalized[i] = strings.ToLower(strings.TrimSpace(checksum))
+	}
+	return normalized
+}
+
+// findOwnedTodo is findTodo for every route under /todos/:id: a todo with
+// an owner is only reachable by requests carrying that owner.
+func findOwnedTodo(c *gin.Context, preloads ...string) (models.Todo, bool) {
+	todo, ok := findTodo(c, preloads...)
+	if !ok {
+		return todo, false
+	}
+	if todo.Owner != "" && c.GetHeader(ownerHeader) != todo.Owner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return todo, false
+	}
+	return todo, true
+}
+
+// ownedTodos is the condition listing the todos findOwnedTodo lets a
+// request reach: those of its owner and those without one.
+func ownedTodos(c *gin.Context) condition {
+	return condition{"owner IN ?", []any{[]string{"", c.GetHeader(ownerHeader)}}}
+}
+
+// findTodo loads the todo named by the :id param along with the given
+// associations. It writes the error response itself and reports whether
+// the caller should carry on.
+func findTodo(c *gin.Context, preloads ...string) (models.Todo, bool) {
+	var todo models.Todo
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return todo, false
+	}
+	query := database.DB
+	for _, preload := range preloads {
+		query = query.Preload(preload)
+	}
+	if err := query.First(&todo, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+		return todo, false
+	}
+	return todo, true
+}
+
+// findAttachment loads the attachment named by the :attachmentId param,
+// scoped to the todo named by :id. It writes the error response itself and
+// reports whether the caller should carry on.
+func findAttachment(c *gin.Context) (models.Attachment, bool) {
+	var attachment models.Attachment
+	todoID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return attachment, false
+	}
+	attachmentID, err := strconv.ParseUint(c.Param("attachmentId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID format"})
+		return attachment, false
+	}
+	err = database.DB.Where("todo_id = ?", todoID).First(&attachment, attachmentID).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return attachment, false
+	}
+	return attachment, true
+}
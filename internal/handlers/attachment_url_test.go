@@ -0,0 +1,94 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/handlers"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAttachmentURL(t *testing.T) {
+	// Setup Gin router and database
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Use real database for test
+	db := setupTestDB()
+	database.DB = db
+	store := storage.NewMemory()
+
+	router.GET("/todos/:id/attachments/:attachmentId/url", func(c *gin.Context) {
+		handlers.GetAttachmentURL(c, db, store)
+	})
+
+	// Insert a todo with one stored attachment
+	store.Put(context.Background(), "report.pdf", strings.NewReader("report"), storage.PutOptions{})
+	todo := models.Todo{
+		Title:       "Test Todo",
+		Attachments: []models.Attachment{{StorageKey: "report.pdf", OriginalFilename: "report.pdf", ScanStatus: models.ScanClean}},
+	}
+	db.Create(&todo)
+	attachmentPath := "/todos/" + strconv.Itoa(int(todo.ID)) + "/attachments/" + strconv.Itoa(int(todo.Attachments[0].ID))
+
+	t.Run("Point at the content route when storage cannot presign", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", attachmentPath+"/url", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var response map[string]string
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, attachmentPath+"/content?download=true", response["url"])
+		_, expires := response["expires_at"]
+		assert.False(t, expires)
+	})
+
+	t.Run("Point at the content route when storage is encrypted", func(t *testing.T) {
+		keys, _ := storage.NewKeyring([][]byte{make([]byte, 32)})
+		encrypted := storage.NewEncrypted(store, keys)
+		encryptedRouter := gin.Default()
+		encryptedRouter.GET("/todos/:id/attachments/:attachmentId/url", func(c *gin.Context) {
+			handlers.GetAttachmentURL(c, db, encrypted)
+		})
+
+		req, _ := http.NewRequest("GET", attachmentPath+"/url", nil)
+		resp := httptest.NewRecorder()
+		encryptedRouter.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		var response map[string]string
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, attachmentPath+"/content?download=true", response["url"])
+	})
+
+	t.Run("Fail when attachment belongs to another todo", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/todos/999999/attachments/"+strconv.Itoa(int(todo.Attachments[0].ID))+"/url", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		assert.Contains(t, resp.Body.String(), "Attachment not found")
+	})
+
+	t.Run("Fail when attachment ID format is invalid", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/todos/"+strconv.Itoa(int(todo.ID))+"/attachments/abc/url", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		assert.Contains(t, resp.Body.String(), "Invalid attachment ID format")
+	})
+
+	truncateTable(db)
+}
@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"todo-app/internal/cleanup"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+	"todo-app/internal/thumbnails"
+)
+
+// Objects are never deleted from storage inline. Every upload starts with a
+// pending deletion in the outbox that only the transaction saving its
+// attachment cancels, and every transaction dropping attachments queues
+// their objects for deletion. The cleanup worker does the rest, so the
+// bucket converges on the database even when requests or deletes fail.
+//
+// Content is deduplicated through blobs: attachments with the same
+// checksum share one object, which is only queued for deletion once the
+// last of them is gone.
+
+// attachmentKeys returns the storage keys of the given attachments.
+func attachmentKeys(attachments []models.Attachment) []string {
+	keys := make([]string, len(attachments))
+	for i, attachment := range attachments {
+		keys[i] = attachment.StorageKey
+	}
+	return keys
+}
+
+// commitUploads claims freshly uploaded objects for attachments about to be
+// saved in tx. An upload whose content is already stored is pointed at the
+// existing blob instead and its own object is discarded, so attachments
+// must be saved after this ran.
+func commitUploads(tx *gorm.DB, attachments []models.Attachment) error {
+	var claimed, duplicates []string
+	for i := range attachments {
+		attachment := &attachments[i]
+		blob := models.Blob{Checksum: attachment.Checksum, StorageKey: attachment.StorageKey, Size: attachment.Size}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&blob).Error; err != nil {
+			return err
+		}
+		if err := lockBlob(tx, attachment.Checksum, &blob); err != nil {
+			return err
+		}
+		blob.RefCount++
+		if err := tx.Save(&blob).Error; err != nil {
+			return err
+		}
+		if blob.StorageKey == attachment.StorageKey {
+			claimed = append(claimed, attachment.StorageKey)
+		} else {
+			duplicates = append(duplicates, attachment.StorageKey)
+			attachment.StorageKey = blob.StorageKey
+		}
+	}
+	if err := cleanup.Cancel(tx, claimed); err != nil {
+		if errors.Is(err, cleanup.ErrAlreadyDeleted) {
+			return errUploadDiscarded
+		}
+		return err
+	}
+	return cleanup.Expedite(tx, duplicates)
+}
+
+// cloneAttachments copies attachments for the todo todoID, which is not
+// saved yet. Content stored as a blob is shared with the copies; content
+// stored before deduplication and thumbnails are copied by the storage
+// backend, and stay queued for deletion like uploads until commitClones
+// claims them. It returns the copies and the keys of the copied objects.
+func cloneAttachments(ctx context.Context, store storage.Storage, todoID uint, attachments []models.Attachment) ([]models.Attachment, []string, error) {
+	if len(attachments) == 0 {
+		return nil, nil, nil
+	}
+	checksums := make([]string, len(attachments))
+	for i, attachment := range attachments {
+		checksums[i] = attachment.Checksum
+	}
+	var blobs []models.Blob
+	if err := database.DB.Where("checksum IN ?", checksums).Find(&blobs).Error; err != nil {
+		return nil, nil, err
+	}
+	blobKeys := make(map[string]string, len(blobs))
+	for _, blob := range blobs {
+		blobKeys[blob.Checksum] = blob.StorageKey
+	}
+	// Thumbnail keys contain the attachment ID, so that has to be known
+	// before anything is copied.
+	ids, err := reserveIDs("attachments", len(attachments))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clones := make([]models.Attachment, len(attachments))
+	var sources, copies []string
+	for i, attachment := range attachments {
+		clone := models.Attachment{
+			ID:               ids[i],
+			TodoID:           todoID,
+			StorageKey:       blobKeys[attachment.Checksum],
+			OriginalFilename: attachment.OriginalFilename,
+			Size:             attachment.Size,
+			ContentType:      attachment.ContentType,
+			Checksum:         attachment.Checksum,
+			UploadedAt:       time.Now(),
+			ScanStatus:       attachment.ScanStatus,
+			ThumbnailStatus:  attachment.ThumbnailStatus,
+		}
+		if clone.StorageKey == "" {
+			clone.StorageKey = storage.NewKey(fmt.Sprintf("todos/%d", todoID), attachment.OriginalFilename)
+			sources = append(sources, attachment.StorageKey)
+			copies = append(copies, clone.StorageKey)
+		}
+		for _, thumbnail := range attachment.Thumbnails {
+			copied := models.Thumbnail{
+				TodoID:      todoID,
+				Size:        thumbnail.Size,
+				Width:       thumbnail.Width,
+				Height:      thumbnail.Height,
+				StorageKey:  thumbnails.Key(clone, thumbnail.Size, path.Ext(thumbnail.StorageKey)),
+				ContentType: thumbnail.ContentType,
+			}
+			clone.Thumbnails = append(clone.Thumbnails, copied)
+			sources = append(sources, thumbnail.StorageKey)
+			copies = append(copies, copied.StorageKey)
+		}
+		clones[i] = clone
+	}
+
+	if err := cleanup.Enqueue(database.DB, copies, time.Now().Add(uploadGrace)); err != nil {
+		return nil, nil, err
+	}
+	for i := range copies {
+		if err := store.Copy(ctx, sources[i], copies[i]); err != nil {
+			abandonUploads(copies)
+			return nil, nil, err
+		}
+	}
+	return clones, copies, nil
+}
+
+// commitClones claims the content of attachment copies about to be saved
+// in tx: shared blobs gain a reference, copied content is committed like an
+// upload and copied thumbnails are taken off the cleanup queue. It fails
+// with gorm.ErrRecordNotFound when shared content went away meanwhile.
+func commitClones(tx *gorm.DB, clones []models.Attachment, copies []string) error {
+	copied := make(map[string]bool, len(copies))
+	for _, key := range copies {
+		copied[key] = true
+	}
+	var thumbnailKeys []string
+	for i := range clones {
+		clone := &clones[i]
+		for _, thumbnail := range clone.Thumbnails {
+			thumbnailKeys = append(thumbnailKeys, thumbnail.StorageKey)
+		}
+		if copied[clone.StorageKey] {
+			if err := commitUploads(tx, clones[i:i+1]); err != nil {
+				return err
+			}
+			continue
+		}
+		var blob models.Blob
+		if err := lockBlob(tx, clone.Checksum, &blob); err != nil {
+			return err
+		}
+		blob.RefCount++
+		if err := tx.Save(&blob).Error; err != nil {
+			return err
+		}
+		clone.StorageKey = blob.StorageKey
+	}
+	return cleanup.Cancel(tx, thumbnailKeys)
+}
+
+// releaseAttachments drops the references of attachments about to be
+// removed in tx, queueing every object no attachment refers to anymore for
+// deletion along with their thumbnails and prior versions. Call it before
+// deleting the rows.
+func releaseAttachments(tx *gorm.DB, attachments []models.Attachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+	released, err := releaseThumbnails(tx, attachments)
+	if err != nil {
+		return err
+	}
+	var versions []models.AttachmentVersion
+	err = tx.Clauses(clause.Returning{}).Where("attachment_id IN ?", attachmentIDs(attachments)).Delete(&versions).Error
+	if err != nil {
+		return err
+	}
+	keys, err := releaseContent(tx, append(versionContents(versions), attachments...))
+	if err != nil {
+		return err
+	}
+	return cleanup.Enqueue(tx, append(released, keys...), time.Now())
+}
+
+// releaseContent drops one reference to the blob of every given content and
+// returns the keys of objects nothing refers to anymore.
+func releaseContent(tx *gorm.DB, contents []models.Attachment) ([]string, error) {
+	var released []string
+	for _, content := range contents {
+		var blob models.Blob
+		err := lockBlob(tx, content.Checksum, &blob)
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && blob.StorageKey != content.StorageKey) {
+			// Stored before deduplication; the object is this content's alone.
+			released = append(released, content.StorageKey)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		blob.RefCount--
+		if blob.RefCount > 0 {
+			if err := tx.Save(&blob).Error; err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := tx.Delete(&blob).Error; err != nil {
+			return nil, err
+		}
+		released = append(released, blob.StorageKey)
+	}
+	return released, nil
+}
+
+// saveAttachments stores claimed attachments of a todo. A file named like
+// an attachment the todo already has becomes a new version of it instead
+// of a second attachment. It returns the saved rows.
+func saveAttachments(tx *gorm.DB, todoID uint, attachments []models.Attachment) ([]models.Attachment, error) {
+	saved := make([]models.Attachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		var current models.Attachment
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("todo_id = ? AND original_filename = ?", todoID, attachment.OriginalFilename).
+			Order("id").
+			First(&current).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			attachment.TodoID = todoID
+			if err := tx.Create(&attachment).Error; err != nil {
+				return nil, err
+			}
+			saved = append(saved, attachment)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := setContent(tx, &current, attachment); err != nil {
+			return nil, err
+		}
+		saved = append(saved, current)
+	}
+	return saved, nil
+}
+
+// setContent makes content the current version of attachment, keeping what
+// it replaces as a prior version and pruning versions beyond the retention
+// limit. attachment must be locked in tx.
+func setContent(tx *gorm.DB, attachment *models.Attachment, content models.Attachment) error {
+	previous := models.AttachmentVersion{
+		AttachmentID: attachment.ID,
+		Version:      attachment.Version,
+		StorageKey:   attachment.StorageKey,
+		Size:         attachment.Size,
+		ContentType:  attachment.ContentType,
+		Checksum:     attachment.Checksum,
+		UploadedAt:   attachment.UploadedAt,
+		ScanStatus:   attachment.ScanStatus,
+	}
+	if err := tx.Create(&previous).Error; err != nil {
+		return err
+	}
+	// Thumbnails show the current content only; the worker makes new ones.
+	released, err := releaseThumbnails(tx, []models.Attachment{*attachment})
+	if err != nil {
+		return err
+	}
+
+	attachment.StorageKey = content.StorageKey
+	attachment.Size = content.Size
+	attachment.ContentType = content.ContentType
+	attachment.Checksum = content.Checksum
+	attachment.UploadedAt = content.UploadedAt
+	attachment.ScanStatus = content.ScanStatus
+	attachment.Version++
+	attachment.ThumbnailStatus = ""
+	attachment.ThumbnailAttempts = 0
+	attachment.Thumbnails = nil
+	err = tx.Model(attachment).
+		Select("storage_key", "size", "content_type", "checksum", "uploaded_at", "scan_status", "version", "thumbnail_status", "thumbnail_attempts").
+		Updates(attachment).Error
+	if err != nil {
+		return err
+	}
+
+	var expired []models.AttachmentVersion
+	err = tx.Where("attachment_id = ?", attachment.ID).
+		Order("version DESC").
+		Offset(int(versionRetention)).
+		Find(&expired).Error
+	if err != nil {
+		return err
+	}
+	if len(expired) > 0 {
+		if err := tx.Delete(&expired).Error; err != nil {
+			return err
+		}
+		keys, err := releaseContent(tx, versionContents(expired))
+		if err != nil {
+			return err
+		}
+		released = append(released, keys...)
+	}
+	return cleanup.Enqueue(tx, released, time.Now())
+}
+
+// versionContents turns prior versions into attachments carrying their
+// content, for the helpers shared with current versions.
+func versionContents(versions []models.AttachmentVersion) []models.Attachment {
+	contents := make([]models.Attachment, len(versions))
+	for i, version := range versions {
+		contents[i] = models.Attachment{
+			ID:          version.AttachmentID,
+			StorageKey:  version.StorageKey,
+			Size:        version.Size,
+			ContentType: version.ContentType,
+			Checksum:    version.Checksum,
+			UploadedAt:  version.UploadedAt,
+			ScanStatus:  version.ScanStatus,
+		}
+	}
+	return contents
+}
+
+// attachmentIDs returns the IDs of the given attachments.
+func attachmentIDs(attachments []models.Attachment) []uint {
+	ids := make([]uint, len(attachments))
+	for i, attachment := range attachments {
+		ids[i] = attachment.ID
+	}
+	return ids
+}
+
+// releaseThumbnails deletes the thumbnails of attachments and returns their
+// keys. The attachments are locked first, so a thumbnail worker still busy
+// with one of them finishes before its thumbnails are looked up.
+func releaseThumbnails(tx *gorm.DB, attachments []models.Attachment) ([]string, error) {
+	ids := attachmentIDs(attachments)
+	var locked []models.Attachment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Find(&locked, ids).Error; err != nil {
+		return nil, err
+	}
+	var thumbnails []models.Thumbnail
+	err := tx.Clauses(clause.Returning{Columns: []clause.Column{{Name: "storage_key"}}}).
+		Where("attachment_id IN ?", ids).
+		Delete(&thumbnails).Error
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(thumbnails))
+	for i, thumbnail := range thumbnails {
+		keys[i] = thumbnail.StorageKey
+	}
+	return keys, nil
+}
+
+// lockBlob loads the blob for checksum and locks it for the rest of tx.
+func lockBlob(tx *gorm.DB, checksum string, blob *models.Blob) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("checksum = ?", checksum).First(blob).Error
+}
+
+// abandonUploads has the worker delete uploaded objects right away after
+// the request failed to save them. Should that fail too, the objects still
+// go once the upload grace period is over.
+func abandonUploads(keys []string) {
+	if err := cleanup.Expedite(database.DB, keys); err != nil {
+		log.Println("Failed to expedite cleanup of abandoned uploads:", err)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/handlers"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAttachmentsArchive(t *testing.T) {
+	// Setup Gin router and database
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Use real database for test
+	db := setupTestDB()
+	database.DB = db
+	store := storage.NewMemory()
+	ctx := context.Background()
+
+	router.GET("/todos/:id/attachments.zip", func(c *gin.Context) {
+		handlers.GetAttachmentsArchive(c, db, store)
+	})
+
+	// Insert a todo with clashing filenames and one unscanned file
+	store.Put(ctx, "todos/1/a/report.txt", strings.NewReader("first report"), storage.PutOptions{})
+	store.Put(ctx, "todos/1/b/report.txt", strings.NewReader("second report"), storage.PutOptions{})
+	store.Put(ctx, "todos/1/c/manifest.json", strings.NewReader("{}"), storage.PutOptions{})
+	store.Put(ctx, "todos/1/d/new.txt", strings.NewReader("not scanned yet"), storage.PutOptions{})
+	todo := models.Todo{
+		Title:       "Archive me",
+		Description: "Four files",
+		Owner:       "alice",
+		Attachments: []models.Attachment{
+			{StorageKey: "todos/1/a/report.txt", OriginalFilename: "report.txt", Size: 12, ScanStatus: models.ScanClean},
+			{StorageKey: "todos/1/b/report.txt", OriginalFilename: "Report.txt", Size: 13, ScanStatus: models.ScanClean},
+			{StorageKey: "todos/1/c/manifest.json", OriginalFilename: "manifest.json", Size: 2, ScanStatus: models.ScanClean},
+			{StorageKey: "todos/1/d/new.txt", OriginalFilename: "new.txt", Size: 15, ScanStatus: models.ScanUnscanned},
+		},
+	}
+	db.Create(&todo)
+	archivePath := "/todos/" + strconv.Itoa(int(todo.ID)) + "/attachments.zip"
+
+	t.Run("Download every attachment as a ZIP", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", archivePath, nil)
+		req.Header.Set("X-Owner-ID", "alice")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "application/zip", resp.Header().Get("Content-Type"))
+		assert.Equal(t, fmt.Sprintf("attachment; filename=todo-%d.zip", todo.ID), resp.Header().Get("Content-Disposition"))
+
+		archive, err := zip.NewReader(bytes.NewReader(resp.Body.Bytes()), int64(resp.Body.Len()))
+		assert.NoError(t, err)
+		contents := map[string]string{}
+		var names []string
+		for _, file := range archive.File {
+			names = append(names, file.Name)
+			r, _ := file.Open()
+			var content bytes.Buffer
+			content.ReadFrom(r)
+			r.Close()
+			contents[file.Name] = content.String()
+		}
+		// Clashing names are numbered and unclean files left out
+		assert.Equal(t, []string{"manifest.json", "report.txt", "Report (2).txt", "manifest (2).json"}, names)
+		assert.Equal(t, "first report", contents["report.txt"])
+		assert.Equal(t, "second report", contents["Report (2).txt"])
+
+		var manifest map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(contents["manifest.json"]), &manifest))
+		assert.Equal(t, "Archive me", manifest["title"])
+		files := manifest["files"].([]any)
+		assert.Len(t, files, 4)
+		skipped := files[3].(map[string]any)
+		assert.Equal(t, "new.txt", skipped["original_filename"])
+		assert.Equal(t, "not_scanned", skipped["skipped"])
+		assert.Nil(t, skipped["name"])
+	})
+
+	t.Run("Deny access to another owner's attachments", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", archivePath, nil)
+		req.Header.Set("X-Owner-ID", "bob")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+	})
+
+	truncateTable(db)
+}
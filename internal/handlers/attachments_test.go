@@ -0,0 +1,232 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"todo-app/internal/cleanup"
+	"todo-app/internal/database"
+	"todo-app/internal/handlers"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttachments(t *testing.T) {
+	// Setup Gin router and database
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Use real database for test
+	db := setupTestDB()
+	database.DB = db
+	store := storage.NewMemory()
+
+	router.GET("/todos/:id/attachments", func(c *gin.Context) { handlers.GetAttachments(c, db) })
+	router.POST("/todos/:id/attachments", func(c *gin.Context) { handlers.AddAttachments(c, db, store) })
+	router.DELETE("/todos/:id/attachments/:attachmentId", func(c *gin.Context) { handlers.DeleteAttachment(c, db, store) })
+	router.GET("/todos/:id/attachments/:attachmentId/versions", func(c *gin.Context) { handlers.GetAttachmentVersions(c, db) })
+	router.POST("/todos/:id/attachments/:attachmentId/versions/:version/restore", func(c *gin.Context) { handlers.RestoreAttachmentVersion(c, db) })
+
+	todo := models.Todo{Title: "Test Todo"}
+	db.Create(&todo)
+	attachmentsPath := "/todos/" + strconv.Itoa(int(todo.ID)) + "/attachments"
+
+	// addFile appends one file to the todo and returns the response
+	addFile := func(name string, content string) *httptest.ResponseRecorder {
+		formData := new(bytes.Buffer)
+		writer := multipart.NewWriter(formData)
+		part, _ := writer.CreateFormFile("files", name)
+		part.Write([]byte(content))
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", attachmentsPath, formData)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("Add attachments one at a time", func(t *testing.T) {
+		resp := addFile("first.txt", "first file")
+		assert.Equal(t, http.StatusCreated, resp.Code)
+		resp = addFile("second.txt", "second file")
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		var added []models.Attachment
+		json.Unmarshal(resp.Body.Bytes(), &added)
+		assert.Len(t, added, 1)
+		assert.Equal(t, "second.txt", added[0].OriginalFilename)
+		assert.Equal(t, "text/plain; charset=utf-8", added[0].ContentType)
+	})
+
+	t.Run("List attachments", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", attachmentsPath, nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var attachments []models.Attachment
+		json.Unmarshal(resp.Body.Bytes(), &attachments)
+		assert.Len(t, attachments, 2)
+		assert.Equal(t, "first.txt", attachments[0].OriginalFilename)
+	})
+
+	t.Run("Delete one attachment and keep the other", func(t *testing.T) {
+		var first models.Attachment
+		db.Where("todo_id = ? AND original_filename = ?", todo.ID, "first.txt").First(&first)
+
+		req, _ := http.NewRequest("DELETE", attachmentsPath+"/"+strconv.Itoa(int(first.ID)), nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var remaining []models.Attachment
+		db.Where("todo_id = ?", todo.ID).Find(&remaining)
+		assert.Len(t, remaining, 1)
+		assert.Equal(t, "second.txt", remaining[0].OriginalFilename)
+
+		// The object goes once the cleanup worker has run
+		err := cleanup.NewWorker(db, store, cleanup.Config{}).ProcessDue(context.Background())
+		assert.NoError(t, err)
+		_, err = store.Stat(context.Background(), first.StorageKey)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		_, err = store.Stat(context.Background(), remaining[0].StorageKey)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Identical content shares one object", func(t *testing.T) {
+		resp := addFile("copy.txt", "second file")
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		var copies []models.Attachment
+		db.Where("todo_id = ?", todo.ID).Order("id").Find(&copies)
+		assert.Len(t, copies, 2)
+		assert.Equal(t, copies[0].StorageKey, copies[1].StorageKey)
+
+		// Removing one copy keeps the object for the other
+		req, _ := http.NewRequest("DELETE", attachmentsPath+"/"+strconv.Itoa(int(copies[1].ID)), nil)
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		err := cleanup.NewWorker(db, store, cleanup.Config{}).ProcessDue(context.Background())
+		assert.NoError(t, err)
+		_, err = store.Stat(context.Background(), copies[0].StorageKey)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Same name creates a new version", func(t *testing.T) {
+		var original models.Attachment
+		db.Where("todo_id = ? AND original_filename = ?", todo.ID, "second.txt").First(&original)
+
+		resp := addFile("second.txt", "second file, revised")
+		assert.Equal(t, http.StatusCreated, resp.Code)
+		var added []models.Attachment
+		json.Unmarshal(resp.Body.Bytes(), &added)
+		assert.Len(t, added, 1)
+		assert.Equal(t, original.ID, added[0].ID)
+		assert.Equal(t, 2, added[0].Version)
+
+		versionsPath := attachmentsPath + "/" + strconv.Itoa(int(original.ID)) + "/versions"
+		req, _ := http.NewRequest("GET", versionsPath, nil)
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		var versions []models.AttachmentVersion
+		json.Unmarshal(resp.Body.Bytes(), &versions)
+		assert.Len(t, versions, 1)
+		assert.Equal(t, 1, versions[0].Version)
+		assert.Equal(t, original.Checksum, versions[0].Checksum)
+
+		// Restoring brings the old content back as the newest version
+		req, _ = http.NewRequest("POST", versionsPath+"/1/restore", nil)
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		var restored models.Attachment
+		json.Unmarshal(resp.Body.Bytes(), &restored)
+		assert.Equal(t, 3, restored.Version)
+		assert.Equal(t, original.Checksum, restored.Checksum)
+		assert.Equal(t, original.StorageKey, restored.StorageKey)
+	})
+
+	t.Run("Fail when no files are sent", func(t *testing.T) {
+		formData := new(bytes.Buffer)
+		writer := multipart.NewWriter(formData)
+		writer.WriteField("title", "ignored")
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", attachmentsPath, formData)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("Deny listing another owner's attachments", func(t *testing.T) {
+		db.Model(&todo).Update("owner", "alice")
+		defer db.Model(&todo).Update("owner", "")
+
+		req, _ := http.NewRequest("GET", attachmentsPath, nil)
+		req.Header.Set("X-Owner-ID", "bob")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+	})
+
+	t.Run("Deny adding to another owner's todo", func(t *testing.T) {
+		db.Model(&todo).Update("owner", "alice")
+		defer db.Model(&todo).Update("owner", "")
+
+		formData := new(bytes.Buffer)
+		writer := multipart.NewWriter(formData)
+		part, _ := writer.CreateFormFile("files", "intruder.txt")
+		part.Write([]byte("not yours"))
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", attachmentsPath, formData)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("X-Owner-ID", "bob")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+
+		var count int64
+		db.Model(&models.Attachment{}).Where("todo_id = ? AND original_filename = ?", todo.ID, "intruder.txt").Count(&count)
+		assert.Zero(t, count)
+	})
+
+	t.Run("Deny deleting another owner's attachment", func(t *testing.T) {
+		db.Model(&todo).Update("owner", "alice")
+		defer db.Model(&todo).Update("owner", "")
+
+		var attachment models.Attachment
+		db.Where("todo_id = ?", todo.ID).First(&attachment)
+
+		req, _ := http.NewRequest("DELETE", attachmentsPath+"/"+strconv.Itoa(int(attachment.ID)), nil)
+		req.Header.Set("X-Owner-ID", "bob")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+
+		var count int64
+		db.Model(&models.Attachment{}).Where("id = ?", attachment.ID).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("Fail when Todo not found", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/todos/999999/attachments", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	truncateTable(db)
+}
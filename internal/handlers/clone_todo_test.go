@@ -0,0 +1,151 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/handlers"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloneTodo(t *testing.T) {
+	// Setup Gin router and database
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Use real database for test
+	db := setupTestDB()
+	database.DB = db
+	store := storage.NewMemory()
+	ctx := context.Background()
+
+	router.POST("/todos/:id/clone", func(c *gin.Context) {
+		handlers.CloneTodo(c, db, store)
+	})
+
+	// One attachment shares a blob, the other was stored before
+	// deduplication and has a thumbnail
+	store.Put(ctx, "todos/1/shared.txt", strings.NewReader("shared"), storage.PutOptions{})
+	store.Put(ctx, "todos/1/legacy.png", strings.NewReader("legacy"), storage.PutOptions{})
+	store.Put(ctx, "todos/1/thumbnails/2/v1-128.png", strings.NewReader("thumb"), storage.PutOptions{})
+	db.Create(&models.Blob{Checksum: "shared", StorageKey: "todos/1/shared.txt", Size: 6, RefCount: 1})
+	todo := models.Todo{
+		Title:       "Original",
+		Description: "Copy me",
+		Owner:       "alice",
+		Completed:   true,
+		Attachments: []models.Attachment{
+			{StorageKey: "todos/1/shared.txt", OriginalFilename: "shared.txt", ContentType: "text/plain", Size: 6, Checksum: "shared", ScanStatus: models.ScanClean},
+			{StorageKey: "todos/1/legacy.png", OriginalFilename: "legacy.png", ContentType: "image/png", Size: 6, Checksum: "legacy", ScanStatus: models.ScanClean, ThumbnailStatus: "done"},
+		},
+	}
+	db.Create(&todo)
+	db.Create(&models.Thumbnail{AttachmentID: todo.Attachments[1].ID, TodoID: todo.ID, Size: 128, StorageKey: "todos/1/thumbnails/2/v1-128.png", ContentType: "image/png"})
+	clonePath := "/todos/" + strconv.Itoa(int(todo.ID)) + "/clone"
+
+	clone := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", clonePath, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Owner-ID", "alice")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("Clone a todo with its attachments", func(t *testing.T) {
+		resp := clone("")
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		var cloned models.Todo
+		json.Unmarshal(resp.Body.Bytes(), &cloned)
+		assert.NotEqual(t, todo.ID, cloned.ID)
+		assert.Equal(t, "Original", cloned.Title)
+		assert.Equal(t, "Copy me", cloned.Description)
+		assert.Equal(t, "alice", cloned.Owner)
+		assert.False(t, cloned.Completed)
+		assert.Len(t, cloned.Attachments, 2)
+
+		var attachments []models.Attachment
+		db.Preload("Thumbnails").Where("todo_id = ?", cloned.ID).Order("id").Find(&attachments)
+		assert.Len(t, attachments, 2)
+
+		// Shared content gains a reference instead of a copy
+		assert.Equal(t, "todos/1/shared.txt", attachments[0].StorageKey)
+		var blob models.Blob
+		db.First(&blob, "checksum = ?", "shared")
+		assert.Equal(t, 2, blob.RefCount)
+
+		// Content without a blob and thumbnails are copied in storage
+		assert.True(t, strings.HasPrefix(attachments[1].StorageKey, fmt.Sprintf("todos/%d/", cloned.ID)))
+		body, _, err := store.Get(ctx, attachments[1].StorageKey)
+		assert.NoError(t, err)
+		var content bytes.Buffer
+		content.ReadFrom(body)
+		assert.Equal(t, "legacy", content.String())
+		assert.Len(t, attachments[1].Thumbnails, 1)
+		_, err = store.Stat(ctx, attachments[1].Thumbnails[0].StorageKey)
+		assert.NoError(t, err)
+
+		// Copies are claimed, nothing is left queued for deletion
+		var pending int64
+		db.Model(&models.PendingDeletion{}).Count(&pending)
+		assert.Equal(t, int64(0), pending)
+	})
+
+	t.Run("Pick fields and attachments", func(t *testing.T) {
+		body := fmt.Sprintf(`{"fields": ["title", "completed"], "attachments": [%d]}`, todo.Attachments[0].ID)
+		resp := clone(body)
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		var cloned models.Todo
+		json.Unmarshal(resp.Body.Bytes(), &cloned)
+		assert.Equal(t, "Original", cloned.Title)
+		assert.Empty(t, cloned.Description)
+		assert.True(t, cloned.Completed)
+		assert.Len(t, cloned.Attachments, 1)
+		assert.Equal(t, "shared.txt", cloned.Attachments[0].OriginalFilename)
+	})
+
+	t.Run("Fail on unknown fields and attachments", func(t *testing.T) {
+		resp := clone(`{"fields": ["owner"]}`)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		assert.Contains(t, resp.Body.String(), "Unknown field")
+
+		resp = clone(`{"attachments": [999999]}`)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		assert.Contains(t, resp.Body.String(), "does not belong to the todo")
+	})
+
+	t.Run("Refuse infected attachments", func(t *testing.T) {
+		infected := todo.Attachments[0]
+		db.Model(&infected).Update("scan_status", models.ScanInfected)
+		defer db.Model(&infected).Update("scan_status", models.ScanClean)
+
+		resp := clone("")
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+		var response map[string]string
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, "malware_detected", response["code"])
+	})
+
+	t.Run("Deny access to another owner's todo", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", clonePath, nil)
+		req.Header.Set("X-Owner-ID", "bob")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+	})
+
+	truncateTable(db)
+}
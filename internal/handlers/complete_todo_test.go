@@ -0,0 +1,94 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/handlers"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompleteTodo(t *testing.T) {
+	// Setup Gin router and database
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Use real database for test
+	db := setupTestDB()
+	database.DB = db
+
+	router.GET("/todos", func(c *gin.Context) { handlers.GetTodos(c, db) })
+	router.POST("/todos/:id/complete", func(c *gin.Context) { handlers.CompleteTodo(c, db) })
+	router.POST("/todos/:id/reopen", func(c *gin.Context) { handlers.ReopenTodo(c, db) })
+
+	t.Run("Complete and reopen a Todo", func(t *testing.T) {
+		todo := models.Todo{Title: "Test Todo", Description: "This is a test todo"}
+		db.Create(&todo)
+
+		// Mark the todo as completed
+		req, _ := http.NewRequest("POST", "/todos/"+strconv.Itoa(int(todo.ID))+"/complete", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var completed models.Todo
+		json.Unmarshal(resp.Body.Bytes(), &completed)
+		assert.True(t, completed.Completed)
+		assert.NotNil(t, completed.CompletedAt)
+
+		// Reopen it again
+		req, _ = http.NewRequest("POST", "/todos/"+strconv.Itoa(int(todo.ID))+"/reopen", nil)
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var reopened models.Todo
+		json.Unmarshal(resp.Body.Bytes(), &reopened)
+		assert.False(t, reopened.Completed)
+		assert.Nil(t, reopened.CompletedAt)
+
+		truncateTable(db)
+	})
+
+	t.Run("Filter Todos by completion", func(t *testing.T) {
+		db.Create(&models.Todo{Title: "Open Todo"})
+		db.Create(&models.Todo{Title: "Done Todo", Completed: true})
+
+		req, _ := http.NewRequest("GET", "/todos?completed=true", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var todos []models.Todo
+		json.Unmarshal(resp.Body.Bytes(), &todos)
+		assert.Len(t, todos, 1)
+		assert.Equal(t, "Done Todo", todos[0].Title)
+
+		truncateTable(db)
+	})
+
+	t.Run("Fail when completed filter is invalid", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/todos?completed=maybe", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("Fail when Todo not found", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/todos/999999/complete", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+
+		var response map[string]string
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, "Todo not found", response["error"])
+	})
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+)
+
+// The ETag of a todo names its version, which every write to the todo or
+// its attachments moves on. What the server derives by itself, like
+// thumbnails and scan results, leaves it alone, so it only changes with
+// what clients change. Writes check If-Match against it; the version column
+// then makes sure nobody changed the todo between that check and the write.
+
+var (
+	errTodoChanged = &requestError{
+		Status:  http.StatusPreconditionFailed,
+		Message: "Todo was changed in the meantime, load it again",
+		Code:    "precondition_failed",
+	}
+	errIfMatchRequired = &requestError{
+		Status:  http.StatusPreconditionRequired,
+		Message: "If-Match header required, send the ETag of the todo",
+		Code:    "precondition_required",
+	}
+)
+
+// entityTag returns the strong ETag of a response body.
+func entityTag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// sortTodo puts the attachments of todo and their thumbnails in a fixed
+// order, so its JSON only changes along with its content.
+func sortTodo(todo *models.Todo) {
+	if todo.Attachments == nil {
+		todo.Attachments = []models.Attachment{}
+	}
+	slices.SortFunc(todo.Attachments, func(a, b models.Attachment) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	for i := range todo.Attachments {
+		slices.SortFunc(todo.Attachments[i].Thumbnails, func(a, b models.Thumbnail) int {
+			return cmp.Compare(a.Size, b.Size)
+		})
+	}
+}
+
+// todoETag returns the ETag of todo.
+func todoETag(todo *models.Todo) string {
+	return fmt.Sprintf(`"%d-%d"`, todo.ID, todo.Version)
+}
+
+// touchTodo moves the version of the todo id on, for writes to its
+// attachments, which have no version column of the todo's to check.
+func touchTodo(tx *gorm.DB, id uint) error {
+	return tx.Model(&models.Todo{}).Where("id = ?", id).UpdateColumns(map[string]any{
+		"version":    gorm.Expr("version + 1"),
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// checkIfMatch evaluates the If-Match header of a write to todo. Without
+// one the write fails with 428 while requireIfMatch is set. It writes the
+// error response itself and reports whether the caller should carry on.
+func checkIfMatch(c *gin.Context, todo *models.Todo) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		if requireIfMatch {
+			respondError(c, errIfMatchRequired, "")
+			return false
+		}
+		return true
+	}
+	etag := todoETag(todo)
+	if !etagMatches(header, etag, false) {
+		c.Header("ETag", etag)
+		respondError(c, errTodoChanged, "")
+		return false
+	}
+	return true
+}
+
+// etagMatches reports whether etag is in the list of an If-Match or
+// If-None-Match header. Weak comparison ignores the W/ prefix; strong
+// comparison never matches weak tags.
+func etagMatches(header string, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// respondTagged sends value as JSON with an ETag of the exact bytes sent.
+func respondTagged(c *gin.Context, status int, value any) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode response"})
+		return
+	}
+	respondWithETag(c, status, entityTag(body), body)
+}
+
+// respondWithETag sends the JSON body with etag. Reads are answered with
+// 304 Not Modified when If-None-Match names it.
+func respondWithETag(c *gin.Context, status int, etag string, body []byte) {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+	if c.Request.Method == http.MethodGet && status == http.StatusOK && etagMatches(c.GetHeader("If-None-Match"), etag, true) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(status, "application/json; charset=utf-8", body)
+}
+
+// respondTodo sends todo with its ETag.
+func respondTodo(c *gin.Context, status int, todo *models.Todo) {
+	sortTodo(todo)
+	body, err := json.Marshal(todo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode response"})
+		return
+	}
+	respondWithETag(c, status, todoETag(todo), body)
+}
+
+// respondSavedTodo reloads a todo that was just written and sends it with
+// its ETag, which is then the one a read would return.
+func respondSavedTodo(c *gin.Context, status int, id uint) {
+	var todo models.Todo
+	if err := database.DB.Preload("Attachments.Thumbnails").First(&todo, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load todo"})
+		return
+	}
+	respondTodo(c, status, &todo)
+}
+
+// saveTodoColumns writes the given columns of todo and moves it to the next
+// version, provided nobody else did since it was loaded. Otherwise it fails
+// with errTodoChanged.
+func saveTodoColumns(tx *gorm.DB, todo *models.Todo, columns ...string) error {
+	version := todo.Version
+	todo.Version++
+	columns = append(columns, "version", "updated_at")
+	result := tx.Model(todo).Where("version = ?", version).Select(columns).Updates(todo)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = errTodoChanged
+	}
+	if result.Error != nil {
+		todo.Version = version
+	}
+	return result.Error
+}
@@ -0,0 +1,147 @@
+package handlers_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/handlers"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	// Setup Gin router and database
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Use real database for test
+	db := setupTestDB()
+	database.DB = db
+	store := storage.NewMemory()
+
+	router.GET("/todos/:id", func(c *gin.Context) {
+		handlers.GetTodoByID(c, db)
+	})
+	router.PATCH("/todos/:id", func(c *gin.Context) {
+		handlers.PatchTodo(c, db)
+	})
+	router.DELETE("/todos/:id", func(c *gin.Context) {
+		handlers.DeleteTodo(c, db, store)
+	})
+	router.DELETE("/todos/:id/attachments/:attachmentId", func(c *gin.Context) {
+		handlers.DeleteAttachment(c, db, store)
+	})
+
+	todo := models.Todo{
+		Title:       "Test Todo",
+		Description: "This is a test todo",
+		Attachments: []models.Attachment{
+			{StorageKey: "todos/1/a/file.txt", OriginalFilename: "file.txt"},
+		},
+	}
+	db.Create(&todo)
+	todoPath := "/todos/" + strconv.Itoa(int(todo.ID))
+
+	send := func(method string, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, todoPath, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := send("GET", "", nil)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	etag := resp.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	t.Run("Answer unchanged reads with 304", func(t *testing.T) {
+		resp := send("GET", "", map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusNotModified, resp.Code)
+		assert.Empty(t, resp.Body.String())
+		assert.Equal(t, etag, resp.Header().Get("ETag"))
+
+		resp = send("GET", "", map[string]string{"If-None-Match": `"stale"`})
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+
+	t.Run("Require If-Match on writes when configured", func(t *testing.T) {
+		t.Cleanup(handlers.InitSettings)
+		t.Setenv("REQUIRE_IF_MATCH", "true")
+		handlers.InitSettings()
+
+		resp := send("PATCH", `{"title": "Blind"}`, nil)
+		assert.Equal(t, http.StatusPreconditionRequired, resp.Code)
+
+		resp = send("DELETE", "", nil)
+		assert.Equal(t, http.StatusPreconditionRequired, resp.Code)
+	})
+
+	t.Run("Write with the current ETag", func(t *testing.T) {
+		resp := send("PATCH", `{"title": "First"}`, map[string]string{"If-Match": etag})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		newETag := resp.Header().Get("ETag")
+		assert.NotEqual(t, etag, newETag)
+
+		var current models.Todo
+		db.First(&current, todo.ID)
+		assert.Equal(t, "First", current.Title)
+		assert.Equal(t, 2, current.Version)
+
+		// The ETag of a write is the one a read returns
+		resp = send("GET", "", map[string]string{"If-None-Match": newETag})
+		assert.Equal(t, http.StatusNotModified, resp.Code)
+	})
+
+	t.Run("Refuse writes with a stale ETag", func(t *testing.T) {
+		resp := send("PATCH", `{"title": "Second"}`, map[string]string{"If-Match": etag})
+		assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+
+		resp = send("DELETE", "", map[string]string{"If-Match": etag})
+		assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+
+		var current models.Todo
+		assert.NoError(t, db.First(&current, todo.ID).Error)
+		assert.Equal(t, "First", current.Title)
+	})
+
+	t.Run("Keep the ETag when the server updates attachments", func(t *testing.T) {
+		resp := send("GET", "", nil)
+		etag := resp.Header().Get("ETag")
+
+		db.Model(&models.Attachment{}).Where("todo_id = ?", todo.ID).Update("scan_status", models.ScanClean)
+		db.Create(&models.Thumbnail{AttachmentID: todo.Attachments[0].ID, TodoID: todo.ID, Size: 256, StorageKey: "thumbnails/file.png"})
+
+		resp = send("GET", "", map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusNotModified, resp.Code)
+	})
+
+	t.Run("Move the ETag on when an attachment is deleted", func(t *testing.T) {
+		resp := send("GET", "", nil)
+		etag := resp.Header().Get("ETag")
+
+		req, _ := http.NewRequest("DELETE", todoPath+"/attachments/"+strconv.Itoa(int(todo.Attachments[0].ID)), nil)
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		resp = send("PATCH", `{"title": "Third"}`, map[string]string{"If-Match": etag})
+		assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+	})
+
+	t.Run("Write without If-Match by default", func(t *testing.T) {
+		resp := send("PATCH", `{"title": "Unchecked"}`, nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+
+	truncateTable(db)
+}
@@ -1,57 +1,52 @@
-package handlers
+package handlers_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"testing"
-	"gorm.io/gorm"
 	"os"
 	"fmt"
+	"strings"
 	"todo-app/internal/database"
 	"todo-app/internal/models"
 	"todo-app/internal/handlers"
+	"todo-app/internal/malware"
+	"todo-app/internal/storage"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
 )
 
-// Truncate the table
-func truncateTable(db *gorm.DB) {
-	db.Exec("TRUNCATE TABLE todos RESTART IDENTITY CASCADE;")
-}
+// eicarScanner flags content containing the EICAR test marker
+type eicarScanner struct{}
 
-// Setup Test Database
-func setupTestDB() *gorm.DB {
-	godotenv.Load("../../.env")
-    dsn := fmt.Sprintf(
-        "host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-        os.Getenv("DB_HOST"),
-        os.Getenv("DB_USER"),
-        os.Getenv("DB_PASSWORD"),
-        os.Getenv("DB_NAME"),
-        os.Getenv("DB_PORT"),
-    )
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+func (eicarScanner) Scan(ctx context.Context, r io.Reader) (malware.Result, error) {
+	content, err := io.ReadAll(r)
 	if err != nil {
-		panic("Failed to connect to test database")
+		return malware.Result{}, err
+	}
+	if bytes.Contains(content, []byte("EICAR")) {
+		return malware.Result{Infected: true, Signature: "Eicar-Signature"}, nil
 	}
-	// Auto Migrate
-	db.AutoMigrate(&models.Todo{})
-	return db
+	return malware.Result{}, nil
 }
 
 // Test CreateTodo API
 func TestCreateTodo(t *testing.T) {
 	db := setupTestDB()
 	database.DB = db
+	store := storage.NewMemory()
 
 	// Setup Gin router
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
 	router.POST("/todos", func(c *gin.Context) {
-		handlers.CreateTodo(c, db)
+		handlers.CreateTodo(c, db, store)
 	})
 
 	t.Run("Fail when no form data is provided", func(t *testing.T) {
@@ -69,5 +64,234 @@ func TestCreateTodo(t *testing.T) {
 		// Truncate table after test
 		truncateTable(db)
 	})
-}
 
+	t.Run("Create Todo from JSON", func(t *testing.T) {
+		body := `{"title": "Todo from JSON", "description": "No form needed", "completed": true}`
+		req, _ := http.NewRequest("POST", "/todos", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		var todo models.Todo
+		json.Unmarshal(resp.Body.Bytes(), &todo)
+		assert.Equal(t, "Todo from JSON", todo.Title)
+		assert.Equal(t, "No form needed", todo.Description)
+		assert.True(t, todo.Completed)
+		assert.NotNil(t, todo.CompletedAt)
+		assert.Empty(t, todo.Attachments)
+
+		truncateTable(db)
+	})
+
+	t.Run("Fail on invalid JSON", func(t *testing.T) {
+		cases := []struct {
+			body   string
+			status int
+			code   string
+		}{
+			{`{"title": `, http.StatusBadRequest, "invalid_json"},
+			{`{"description": "No title"}`, http.StatusUnprocessableEntity, "invalid_field"},
+			{`{"title": 42}`, http.StatusUnprocessableEntity, "invalid_field"},
+			{`{"title": "Typo", "descripton": "x"}`, http.StatusUnprocessableEntity, "invalid_field"},
+		}
+		for _, tc := range cases {
+			req, _ := http.NewRequest("POST", "/todos", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+			assert.Equal(t, tc.status, resp.Code, tc.body)
+			var response map[string]any
+			json.Unmarshal(resp.Body.Bytes(), &response)
+			assert.Equal(t, tc.code, response["code"], tc.body)
+		}
+
+		var count int64
+		db.Model(&models.Todo{}).Count(&count)
+		assert.Equal(t, int64(0), count)
+	})
+
+	t.Run("Create Todo with attachments", func(t *testing.T) {
+		formData := new(bytes.Buffer)
+		writer := multipart.NewWriter(formData)
+		writer.WriteField("title", "Todo with files")
+		writer.WriteField("description", "Has two attachments")
+		part, _ := writer.CreateFormFile("files", "first.txt")
+		part.Write([]byte("first file"))
+		part, _ = writer.CreateFormFile("files", "second.txt")
+		part.Write([]byte("second file"))
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", "/todos", formData)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		var todo models.Todo
+		json.Unmarshal(resp.Body.Bytes(), &todo)
+		assert.Len(t, todo.Attachments, 2)
+
+		// Every attachment should be backed by a stored object namespaced by the todo
+		var attachments []models.Attachment
+		db.Where("todo_id = ?", todo.ID).Find(&attachments)
+		assert.Len(t, attachments, 2)
+		for _, attachment := range attachments {
+			assert.True(t, strings.HasPrefix(attachment.StorageKey, fmt.Sprintf("todos/%d/", todo.ID)))
+			_, err := store.Stat(req.Context(), attachment.StorageKey)
+			assert.NoError(t, err)
+		}
+		assert.NotEqual(t, attachments[0].StorageKey, attachments[1].StorageKey)
+
+		truncateTable(db)
+	})
+
+	t.Run("Fail when a file exceeds the maximum size", func(t *testing.T) {
+		os.Setenv("MAX_UPLOAD_FILE_SIZE", "8")
+		handlers.InitSettings()
+		defer func() {
+			os.Unsetenv("MAX_UPLOAD_FILE_SIZE")
+			handlers.InitSettings()
+		}()
+
+		formData := new(bytes.Buffer)
+		writer := multipart.NewWriter(formData)
+		writer.WriteField("title", "Todo with a large file")
+		part, _ := writer.CreateFormFile("files", "large.txt")
+		part.Write([]byte("more than eight bytes"))
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", "/todos", formData)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		// Expect a 413 and no todo left behind
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+		var count int64
+		db.Model(&models.Todo{}).Count(&count)
+		assert.Equal(t, int64(0), count)
+
+		truncateTable(db)
+	})
+
+	t.Run("Fail when a file type is not allowed", func(t *testing.T) {
+		os.Setenv("ATTACHMENT_ALLOWED_TYPES", "image/*,application/pdf")
+		handlers.InitSettings()
+		defer func() {
+			os.Unsetenv("ATTACHMENT_ALLOWED_TYPES")
+			handlers.InitSettings()
+		}()
+
+		// The extension claims an image but the content is plain text
+		formData := new(bytes.Buffer)
+		writer := multipart.NewWriter(formData)
+		writer.WriteField("title", "Todo with a disguised file")
+		part, _ := writer.CreateFormFile("files", "picture.png")
+		part.Write([]byte("just some text"))
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", "/todos", formData)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, resp.Code)
+		var response map[string]string
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, "unsupported_media_type", response["code"])
+		assert.Equal(t, "text/plain", response["content_type"])
+
+		truncateTable(db)
+	})
+
+	t.Run("Quarantine infected files", func(t *testing.T) {
+		handlers.InitScanner(eicarScanner{})
+		defer handlers.InitScanner(malware.Nop{})
+
+		formData := new(bytes.Buffer)
+		writer := multipart.NewWriter(formData)
+		writer.WriteField("title", "Todo with an infected file")
+		part, _ := writer.CreateFormFile("files", "clean.txt")
+		part.Write([]byte("nothing to see"))
+		part, _ = writer.CreateFormFile("files", "invoice.txt")
+		part.Write([]byte("X5O!P%@AP[4\\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*"))
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", "/todos", formData)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("X-Owner-ID", "alice")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+		var response map[string]string
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, "malware_detected", response["code"])
+		assert.Equal(t, "invoice.txt", response["filename"])
+		assert.Equal(t, "Eicar-Signature", response["signature"])
+
+		// No todo is created, the infected file is kept in quarantine and
+		// only the clean one is queued for deletion
+		var count int64
+		db.Model(&models.Todo{}).Count(&count)
+		assert.Equal(t, int64(0), count)
+		var quarantined []models.QuarantinedFile
+		db.Find(&quarantined)
+		assert.Len(t, quarantined, 1)
+		assert.Equal(t, "alice", quarantined[0].Owner)
+		assert.Equal(t, "invoice.txt", quarantined[0].Filename)
+		var pending []models.PendingDeletion
+		db.Find(&pending)
+		assert.Len(t, pending, 1)
+		assert.NotEqual(t, quarantined[0].StorageKey, pending[0].StorageKey)
+
+		truncateTable(db)
+	})
+
+	t.Run("Record the scan status", func(t *testing.T) {
+		handlers.InitScanner(eicarScanner{})
+		defer handlers.InitScanner(malware.Nop{})
+
+		formData := new(bytes.Buffer)
+		writer := multipart.NewWriter(formData)
+		writer.WriteField("title", "Todo with a clean file")
+		part, _ := writer.CreateFormFile("files", "clean.txt")
+		part.Write([]byte("nothing to see"))
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", "/todos", formData)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusCreated, resp.Code)
+		var todo models.Todo
+		json.Unmarshal(resp.Body.Bytes(), &todo)
+		assert.Equal(t, models.ScanClean, todo.Attachments[0].ScanStatus)
+
+		truncateTable(db)
+	})
+
+	t.Run("Record skipped scans without a scanner", func(t *testing.T) {
+		formData := new(bytes.Buffer)
+		writer := multipart.NewWriter(formData)
+		writer.WriteField("title", "Todo with an unchecked file")
+		part, _ := writer.CreateFormFile("files", "unchecked.txt")
+		part.Write([]byte("nothing to see"))
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", "/todos", formData)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusCreated, resp.Code)
+		var todo models.Todo
+		json.Unmarshal(resp.Body.Bytes(), &todo)
+		assert.Equal(t, models.ScanSkipped, todo.Attachments[0].ScanStatus)
+
+		truncateTable(db)
+	})
+}
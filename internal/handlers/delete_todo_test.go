@@ -1,4 +1,4 @@
-package handlers
+package handlers_test
 
 import (
 	// "bytes"
@@ -6,45 +6,16 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
-	"gorm.io/gorm"
-	"os"
-	"fmt"
 	"strconv"
 	"todo-app/internal/database"
 	"todo-app/internal/models"
 	"todo-app/internal/handlers"
+	"todo-app/internal/storage"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
 )
 
-// Truncate the table
-func truncateTable(db *gorm.DB) {
-	db.Exec("TRUNCATE TABLE todos RESTART IDENTITY CASCADE;")
-}
-
-// Setup Test Database
-func setupTestDB() *gorm.DB {
-	godotenv.Load("../../.env")
-    dsn := fmt.Sprintf(
-        "host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-        os.Getenv("DB_HOST"),
-        os.Getenv("DB_USER"),
-        os.Getenv("DB_PASSWORD"),
-        os.Getenv("DB_NAME"),
-        os.Getenv("DB_PORT"),
-    )
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		panic("Failed to connect to test database")
-	}
-	// Auto Migrate
-	db.AutoMigrate(&models.Todo{})
-	return db
-}
-
 func TestDeleteTodo(t *testing.T) {
 	// Setup Gin router and database
 	gin.SetMode(gin.TestMode)
@@ -53,10 +24,11 @@ func TestDeleteTodo(t *testing.T) {
 	// Use real database for test
 	db := setupTestDB()
 	database.DB = db
+	store := storage.NewMemory()
 
 	// Test DELETE endpoint
 	router.DELETE("/todos/:id", func(c *gin.Context) {
-		handlers.DeleteTodo(c, db)
+		handlers.DeleteTodo(c, db, store)
 	})
 
 	t.Run("Delete a Todo successfully", func(t *testing.T) {
@@ -64,12 +36,15 @@ func TestDeleteTodo(t *testing.T) {
 		todo := models.Todo{
 			Title:       "Test Todo",
 			Description: "This is a test todo",
-			Attachment:  "some/path/to/file.jpg",
+			Attachments: []models.Attachment{
+				{StorageKey: "file.jpg", OriginalFilename: "file.jpg"},
+			},
 		}
 		db.Create(&todo)
 
 		// Send DELETE request
 		req, _ := http.NewRequest("DELETE", "/todos/"+strconv.Itoa(int(todo.ID)), nil)
+		req.Header.Set("If-Match", "*")
 		resp := httptest.NewRecorder()
 		router.ServeHTTP(resp, req)
 
@@ -81,13 +56,18 @@ func TestDeleteTodo(t *testing.T) {
 		err := db.First(&deletedTodo, todo.ID).Error
 		assert.Error(t, err) // Expected error as the todo should be deleted
 
+		// Verify its attachments are gone as well
+		var attachmentCount int64
+		db.Model(&models.Attachment{}).Where("todo_id = ?", todo.ID).Count(&attachmentCount)
+		assert.Equal(t, int64(0), attachmentCount)
+
 		// Cleanup: truncate the table
 		truncateTable(db)
 	})
 
 	t.Run("Fail when Todo not found", func(t *testing.T) {
 		// Send DELETE request for a non-existing todo
-		req, _ := http.NewRequest("DELETE", "/todos/non-existing-id", nil)
+		req, _ := http.NewRequest("DELETE", "/todos/999999", nil)
 		resp := httptest.NewRecorder()
 		router.ServeHTTP(resp, req)
 
@@ -99,4 +79,29 @@ func TestDeleteTodo(t *testing.T) {
 		json.Unmarshal(resp.Body.Bytes(), &response)
 		assert.Equal(t, "Todo not found", response["error"])
 	})
+	t.Run("Fail with invalid ID format", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", "/todos/abc", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		var response map[string]string
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		assert.Equal(t, "Invalid ID format", response["error"])
+	})
+
+	t.Run("Fail when Todo belongs to another owner", func(t *testing.T) {
+		todo := models.Todo{Title: "Private", Owner: "alice"}
+		db.Create(&todo)
+
+		req, _ := http.NewRequest("DELETE", "/todos/"+strconv.Itoa(int(todo.ID)), nil)
+		req.Header.Set("X-Owner-ID", "bob")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+		assert.NoError(t, db.First(&models.Todo{}, todo.ID).Error)
+		truncateTable(db)
+	})
 }
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestError is an error that maps onto a specific HTTP response. Code and
+// Details are optional and give clients something to act on beyond the
+// human readable message.
+type requestError struct {
+	Status  int
+	Message string
+	Code    string
+	Details gin.H
+}
+
+func (e *requestError) Error() string {
+	return e.Message
+}
+
+var (
+	errInvalidForm      = &requestError{Status: http.StatusBadRequest, Message: "Failed to parse form"}
+	errRequestTooLarge  = &requestError{Status: http.StatusRequestEntityTooLarge, Message: "Request body too large", Code: "request_too_large"}
+	errFileUploadFailed = &requestError{Status: http.StatusInternalServerError, Message: "File upload failed"}
+	// errUploadDiscarded is a file that took longer than the upload grace
+	// period to save, so the cleanup worker deleted it in the meantime.
+	errUploadDiscarded = &requestError{Status: http.StatusServiceUnavailable, Message: "Upload took too long and was discarded, send it again", Code: "upload_discarded"}
+)
+
+// errorResponse is the body of an error response, for the API docs. Some
+// errors carry details next to the code, like the field or parameter at
+// fault.
+type errorResponse struct {
+	Error string `json:"error" example:"Todo not found"`
+	Code  string `json:"code,omitempty" example:"invalid_field"`
+}
+
+// respondError writes err as a JSON error response. Errors that don't carry
+// their own status are reported as 500 with the fallback message.
+func respondError(c *gin.Context, err error, fallback string) {
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+		return
+	}
+	body := gin.H{"error": reqErr.Message}
+	if reqErr.Code != "" {
+		body["code"] = reqErr.Code
+	}
+	for key, value := range reqErr.Details {
+		body[key] = value
+	}
+	c.JSON(reqErr.Status, body)
+}
@@ -1,4 +1,4 @@
-package handlers
+package handlers_test
 
 import (
 	// "bytes"
@@ -6,8 +6,6 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strconv"
-	"os"
-	"fmt"
 	"testing"
 	"todo-app/internal/database"
 	"todo-app/internal/models"
@@ -15,36 +13,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
-	"github.com/joho/godotenv"
 )
 
-// Truncate the table
-func truncateTable(db *gorm.DB) {
-	db.Exec("TRUNCATE TABLE todos RESTART IDENTITY CASCADE;")
-}
-
-// Setup Test Database
-func setupTestDB() *gorm.DB {
-	godotenv.Load("../../.env")
-    dsn := fmt.Sprintf(
-        "host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-        os.Getenv("DB_HOST"),
-        os.Getenv("DB_USER"),
-        os.Getenv("DB_PASSWORD"),
-        os.Getenv("DB_NAME"),
-        os.Getenv("DB_PORT"),
-    )
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		panic("Failed to connect to test database")
-	}
-	// Auto Migrate
-	db.AutoMigrate(&models.Todo{})
-	return db
-}
-
 // Test GetTodoByID Handler
 func TestGetTodoByID(t *testing.T) {
 	// Initialize test DB
@@ -98,4 +68,18 @@ func TestGetTodoByID(t *testing.T) {
 		assert.Contains(t, resp.Body.String(), "Todo not found")
 		truncateTable(db)
 	})
+
+	// Test Case: Another owner's todo
+	t.Run("Fail when todo belongs to another owner", func(t *testing.T) {
+		owned := models.Todo{Title: "Private", Owner: "alice"}
+		db.Create(&owned)
+
+		req, _ := http.NewRequest("GET", "/todos/"+strconv.Itoa(int(owned.ID)), nil)
+		req.Header.Set("X-Owner-ID", "bob")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+		truncateTable(db)
+	})
 }
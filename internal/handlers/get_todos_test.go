@@ -1,48 +1,19 @@
-package handlers
+package handlers_test
 
 import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"testing"
-	"os"
-	"fmt"
 	"todo-app/internal/database"
 	"todo-app/internal/models"
 	"todo-app/internal/handlers"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/gorm"
-	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
 )
 
-// Truncate the table
-func truncateTable(db *gorm.DB) {
-	db.Exec("TRUNCATE TABLE todos RESTART IDENTITY CASCADE;")
-}
-
-// Setup Test Database
-func setupTestDB() *gorm.DB {
-	godotenv.Load("../../.env")
-    dsn := fmt.Sprintf(
-        "host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-        os.Getenv("DB_HOST"),
-        os.Getenv("DB_USER"),
-        os.Getenv("DB_PASSWORD"),
-        os.Getenv("DB_NAME"),
-        os.Getenv("DB_PORT"),
-    )
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		panic("Failed to connect to test database")
-	}
-	// Auto Migrate
-	db.AutoMigrate(&models.Todo{})
-	return db
-}
-
 // Test GetTodos Handler
 func TestGetTodos(t *testing.T) {
 	// Initialize test DB
@@ -96,4 +67,115 @@ func TestGetTodos(t *testing.T) {
 		assert.Len(t, responseTodos, 0) // Expect empty array
 		truncateTable(db)
 	})
+
+	// Test Case: Page through todos sorted by title
+	t.Run("Paginate with a cursor", func(t *testing.T) {
+		db.Create(&[]models.Todo{
+			{Title: "Banana", Description: "Fruit"},
+			{Title: "Apple", Description: "Fruit"},
+			{Title: "Cherry", Description: "Fruit"},
+			{Title: "Apple", Description: "Another fruit"},
+			{Title: "Date", Description: "Vegetable?"},
+		})
+
+		var titles []string
+		path := "/todos?sort=-title&limit=2&count=true"
+		for pages := 0; path != ""; pages++ {
+			req, _ := http.NewRequest("GET", path, nil)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, "5", resp.Header().Get("X-Total-Count"))
+
+			var page []models.Todo
+			json.Unmarshal(resp.Body.Bytes(), &page)
+			for _, todo := range page {
+				titles = append(titles, todo.Title)
+			}
+			path = ""
+			if match := regexp.MustCompile(`<(.+)>; rel="next"`).FindStringSubmatch(resp.Header().Get("Link")); match != nil {
+				path = match[1]
+			}
+			assert.Less(t, pages, 3)
+		}
+		// Equal titles come in descending ID order as well
+		assert.Equal(t, []string{"Date", "Cherry", "Banana", "Apple", "Apple"}, titles)
+		truncateTable(db)
+	})
+
+	// Test Case: Filter by substring, completion and dates
+	t.Run("Filter todos", func(t *testing.T) {
+		db.Create(&[]models.Todo{
+			{Title: "Write report", Description: "Quarterly numbers"},
+			{Title: "Review REPORT", Description: "100% done", Completed: true},
+			{Title: "Buy milk", Description: "Semi_skimmed"},
+		})
+
+		for query, want := range map[string]int{
+			"title=report":                        2,
+			"title=report&completed=false":        1,
+			"description=%25":                     1,
+			"description=semi_":                   1,
+			"title=e_r":                           0,
+			"created_since=2000-01-01":            3,
+			"created_before=2000-01-01T00:00:00Z": 0,
+		} {
+			req, _ := http.NewRequest("GET", "/todos?"+query, nil)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+			assert.Equal(t, http.StatusOK, resp.Code, query)
+
+			var todos []models.Todo
+			json.Unmarshal(resp.Body.Bytes(), &todos)
+			assert.Len(t, todos, want, query)
+		}
+		truncateTable(db)
+	})
+
+	// Test Case: Leave out other owners' todos
+	t.Run("List only the requester's todos", func(t *testing.T) {
+		db.Create(&[]models.Todo{
+			{Title: "Shared"},
+			{Title: "Alice's", Owner: "alice"},
+			{Title: "Bob's", Owner: "bob"},
+		})
+
+		req, _ := http.NewRequest("GET", "/todos?sort=title", nil)
+		req.Header.Set("X-Owner-ID", "alice")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var todos []models.Todo
+		json.Unmarshal(resp.Body.Bytes(), &todos)
+		if assert.Len(t, todos, 2) {
+			assert.Equal(t, "Alice's", todos[0].Title)
+			assert.Equal(t, "Shared", todos[1].Title)
+		}
+		truncateTable(db)
+	})
+
+	// Test Case: Reject parameters that can't be used
+	t.Run("Fail on invalid parameters", func(t *testing.T) {
+		for query, parameter := range map[string]string{
+			"limit=0":                 "limit",
+			"limit=1000":              "limit",
+			"sort=owner":              "sort",
+			"cursor=garbage":          "cursor",
+			"created_since=yesterday": "created_since",
+			"count=maybe":             "count",
+			// A cursor handed out for another sort
+			"sort=title&cursor=eyJzIjoiaWQiLCJpZCI6MX0": "cursor",
+		} {
+			req, _ := http.NewRequest("GET", "/todos?"+query, nil)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+
+			var response map[string]string
+			json.Unmarshal(resp.Body.Bytes(), &response)
+			assert.Equal(t, "invalid_parameter", response["code"], query)
+			assert.Equal(t, parameter, response["parameter"], query)
+		}
+	})
 }
@@ -0,0 +1,46 @@
+package handlers_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"todo-app/internal/database"
+
+	"github.com/joho/godotenv"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Truncate every table of the schema
+func truncateTable(db *gorm.DB) {
+	tables := make([]string, len(database.Models))
+	for i, model := range database.Models {
+		statement := &gorm.Statement{DB: db}
+		if err := statement.Parse(model); err != nil {
+			panic(err)
+		}
+		tables[i] = statement.Schema.Table
+	}
+	db.Exec("TRUNCATE TABLE " + strings.Join(tables, ", ") + " RESTART IDENTITY CASCADE;")
+}
+
+// Setup Test Database, migrated like the server migrates it
+func setupTestDB() *gorm.DB {
+	godotenv.Load("../../.env")
+	dsn := fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
+		os.Getenv("DB_HOST"),
+		os.Getenv("DB_USER"),
+		os.Getenv("DB_PASSWORD"),
+		os.Getenv("DB_NAME"),
+		os.Getenv("DB_PORT"),
+	)
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		panic("Failed to connect to test database")
+	}
+	if err := database.Migrate(db); err != nil {
+		panic("Failed to migrate test database: " + err.Error())
+	}
+	return db
+}
@@ -0,0 +1,145 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/handlers"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchTodo(t *testing.T) {
+	// Setup Gin router and database
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Use real database for test
+	db := setupTestDB()
+	database.DB = db
+
+	router.PATCH("/todos/:id", func(c *gin.Context) {
+		handlers.PatchTodo(c, db)
+	})
+
+	todo := models.Todo{Title: "Test Todo", Description: "This is a test todo"}
+	db.Create(&todo)
+	todoPath := "/todos/" + strconv.Itoa(int(todo.ID))
+
+	patch := func(contentType string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PATCH", todoPath, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("If-Match", "*")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+	load := func() models.Todo {
+		var current models.Todo
+		db.First(&current, todo.ID)
+		return current
+	}
+	code := func(resp *httptest.ResponseRecorder) any {
+		var response map[string]any
+		json.Unmarshal(resp.Body.Bytes(), &response)
+		return response["code"]
+	}
+
+	t.Run("Apply a merge patch", func(t *testing.T) {
+		resp := patch("application/merge-patch+json", `{"completed": true}`)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		current := load()
+		assert.Equal(t, "Test Todo", current.Title)
+		assert.Equal(t, "This is a test todo", current.Description)
+		assert.True(t, current.Completed)
+		assert.NotNil(t, current.CompletedAt)
+
+		// null removes a member
+		resp = patch("application/merge-patch+json", `{"title": "Patched", "description": null}`)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		current = load()
+		assert.Equal(t, "Patched", current.Title)
+		assert.Empty(t, current.Description)
+		assert.True(t, current.Completed)
+	})
+
+	t.Run("Apply a JSON patch", func(t *testing.T) {
+		resp := patch("application/json-patch+json", `[
+			{"op": "test", "path": "/title", "value": "Patched"},
+			{"op": "copy", "from": "/title", "path": "/description"},
+			{"op": "replace", "path": "/title", "value": "Patched twice"},
+			{"op": "replace", "path": "/completed", "value": false}
+		]`)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		current := load()
+		assert.Equal(t, "Patched twice", current.Title)
+		assert.Equal(t, "Patched", current.Description)
+		assert.False(t, current.Completed)
+		assert.Nil(t, current.CompletedAt)
+	})
+
+	t.Run("Apply nothing when a test fails", func(t *testing.T) {
+		resp := patch("application/json-patch+json", `[
+			{"op": "replace", "path": "/title", "value": "Lost"},
+			{"op": "test", "path": "/description", "value": "Something else"}
+		]`)
+		assert.Equal(t, http.StatusConflict, resp.Code)
+		assert.Equal(t, "test_failed", code(resp))
+		assert.Equal(t, "Patched twice", load().Title)
+	})
+
+	t.Run("Fail on invalid patches", func(t *testing.T) {
+		cases := []struct {
+			contentType string
+			body        string
+			status      int
+			code        string
+		}{
+			{"application/merge-patch+json", `[]`, http.StatusBadRequest, "invalid_patch"},
+			{"application/merge-patch+json", `{"title": null}`, http.StatusUnprocessableEntity, "invalid_field"},
+			{"application/merge-patch+json", `{"title": ""}`, http.StatusUnprocessableEntity, "invalid_field"},
+			{"application/merge-patch+json", `{"completed": "yes"}`, http.StatusUnprocessableEntity, "invalid_field"},
+			{"application/merge-patch+json", `{"owner": "mallory"}`, http.StatusUnprocessableEntity, "invalid_field"},
+			{"application/json-patch+json", `[{"op": "jump", "path": "/title"}]`, http.StatusBadRequest, "invalid_patch"},
+			{"application/json-patch+json", `[{"op": "replace", "path": "/title"}]`, http.StatusBadRequest, "invalid_patch"},
+			{"application/json-patch+json", `[{"op": "remove", "path": "/owner"}]`, http.StatusUnprocessableEntity, "patch_failed"},
+			{"text/plain", `title=Nope`, http.StatusUnsupportedMediaType, "unsupported_media_type"},
+		}
+		for _, tc := range cases {
+			resp := patch(tc.contentType, tc.body)
+			assert.Equal(t, tc.status, resp.Code, tc.body)
+			assert.Equal(t, tc.code, code(resp), tc.body)
+		}
+		assert.Equal(t, "Patched twice", load().Title)
+	})
+
+	t.Run("Fail when Todo not found", func(t *testing.T) {
+		req, _ := http.NewRequest("PATCH", "/todos/999999", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("Fail when Todo belongs to another owner", func(t *testing.T) {
+		owned := models.Todo{Title: "Private", Owner: "alice"}
+		db.Create(&owned)
+
+		req, _ := http.NewRequest("PATCH", "/todos/"+strconv.Itoa(int(owned.ID)), bytes.NewBufferString(`{"title": "Taken"}`))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		req.Header.Set("X-Owner-ID", "bob")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+
+		db.First(&owned, owned.ID)
+		assert.Equal(t, "Private", owned.Title)
+	})
+
+	truncateTable(db)
+}
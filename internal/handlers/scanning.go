@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"todo-app/internal/cleanup"
+	"todo-app/internal/malware"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+)
+
+// Uploads are scanned for malware once they are stored and before they are
+// committed, so content nothing has scanned never becomes an attachment.
+// Infected uploads are quarantined instead: their objects stay out of the
+// cleanup outbox and are recorded for an administrator to look at.
+
+// fileScanner checks uploads for malware. It passes everything until
+// InitScanner sets a real one.
+var fileScanner malware.Scanner = malware.Nop{}
+
+// InitScanner sets the scanner uploads are checked with.
+func InitScanner(scanner malware.Scanner) {
+	fileScanner = scanner
+}
+
+var (
+	errScanFailed = &requestError{
+		Status:  http.StatusServiceUnavailable,
+		Message: "Files could not be scanned for malware",
+		Code:    "scan_failed",
+	}
+	errContentInfected = &requestError{
+		Status:  http.StatusForbidden,
+		Message: "Attachment content is infected",
+		Code:    "malware_detected",
+	}
+	errContentUnscanned = &requestError{
+		Status:  http.StatusForbidden,
+		Message: "Attachment content has not been scanned for malware",
+		Code:    "not_scanned",
+	}
+)
+
+// malwareError reports an upload the scanner flagged.
+func malwareError(filename string, signature string) *requestError {
+	return &requestError{
+		Status:  http.StatusUnprocessableEntity,
+		Message: fmt.Sprintf("File %q contains malware", filename),
+		Code:    "malware_detected",
+		Details: gin.H{"filename": filename, "signature": signature},
+	}
+}
+
+// scanUpload scans the stored object of an upload with fileScanner.
+func scanUpload(ctx context.Context, store storage.Storage, key string) (malware.Result, error) {
+	result, err := malware.ScanObject(ctx, store, fileScanner, key)
+	if err != nil {
+		log.Printf("Failed to scan %q: %v", key, err)
+		return result, errScanFailed
+	}
+	return result, nil
+}
+
+// quarantine records infected uploads and takes their objects off the
+// cleanup outbox, keeping them for inspection.
+func quarantine(tx *gorm.DB, files []models.QuarantinedFile) error {
+	if len(files) == 0 {
+		return nil
+	}
+	if err := tx.Create(&files).Error; err != nil {
+		return err
+	}
+	keys := make([]string, len(files))
+	for i, file := range files {
+		keys[i] = file.StorageKey
+		log.Printf("Quarantining %q uploaded by %q: %s", file.Filename, file.Owner, file.Signature)
+	}
+	return cleanup.Cancel(tx, keys)
+}
+
+// servable reports whether content with scanStatus may be served with the
+// current scanner.
+func servable(scanStatus string) bool {
+	return slices.Contains(malware.ServableStatuses(fileScanner), scanStatus)
+}
+
+// checkServable refuses content the scanner has not found clean. It writes
+// the error response itself and reports whether the caller should carry
+// on.
+func checkServable(c *gin.Context, scanStatus string) bool {
+	switch {
+	case servable(scanStatus):
+		return true
+	case scanStatus == models.ScanInfected:
+		respondError(c, errContentInfected, "")
+	default:
+		respondError(c, errContentUnscanned, "")
+	}
+	return false
+}
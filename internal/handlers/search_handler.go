@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+)
+
+const defaultSearchLimit = 20
+
+// Matches are marked with characters from the private use area, which
+// don't occur in regular text, and only turned into tags once the rest of
+// the snippet is escaped.
+const (
+	matchStart = "\ue000"
+	matchStop  = "\ue001"
+)
+
+// Options for ts_headline: titles are shown whole, descriptions are cut
+// down to the passages around the matches.
+const (
+	titleHeadline       = "HighlightAll=true, StartSel=" + matchStart + ", StopSel=" + matchStop
+	descriptionHeadline = "MaxFragments=3, MaxWords=20, MinWords=5, FragmentDelimiter=\" … \", StartSel=" + matchStart + ", StopSel=" + matchStop
+)
+
+// searchResult is a todo matching a search, with how well it matched and
+// its text as HTML with the matches marked up.
+type searchResult struct {
+	Todo      models.Todo     `json:"todo"`
+	Rank      float64         `json:"rank"`
+	Highlight searchHighlight `json:"highlight"`
+}
+
+type searchHighlight struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// SearchTodos finds todos by the words in their title and description.
+// The q parameter takes web search syntax: quoted phrases, "or" and a
+// leading "-" to exclude a word. Results come best match first, at most
+// limit of them.
+//
+//	@Summary	Search todos
+//	@Tags		todos
+//	@Produce	json
+//	@Param		q			query		string	true	"Words to look for, in web search syntax"
+//	@Param		limit		query		int		false	"Results to return"	minimum(1)	maximum(200)	default(20)
+//	@Param		X-Owner-ID	header		string	false	"Owner whose todos to search, next to those without an owner"
+//	@Success	200			{array}		searchResult
+//	@Failure	400			{object}	errorResponse
+//	@Router		/todos/search [get]
+func SearchTodos(c *gin.Context, db *gorm.DB) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		respondError(c, invalidParameter("q", "Missing search query"), "")
+		return
+	}
+	limit := defaultSearchLimit
+	if value := c.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			respondError(c, invalidParameter("limit", fmt.Sprintf("Invalid limit, must be between 1 and %d", maxPageLimit)), "")
+			return
+		}
+	}
+
+	var matches []struct {
+		ID                   uint
+		Rank                 float64
+		TitleHighlight       string
+		DescriptionHighlight string
+	}
+	// Only todos findOwnedTodo would let the request reach, see ownedTodos.
+	err := database.DB.Raw(`
+		SELECT id, ts_rank_cd(search_vector, query) AS rank,
+			ts_headline(?::regconfig, title, query, ?) AS title_highlight,
+			ts_headline(?::regconfig, description, query, ?) AS description_highlight
+		FROM todos, websearch_to_tsquery(?::regconfig, ?) AS query
+		WHERE search_vector @@ query AND owner IN ?
+		ORDER BY rank DESC, id
+		LIMIT ?`,
+		database.SearchLanguage, titleHeadline,
+		database.SearchLanguage, descriptionHeadline,
+		database.SearchLanguage, q, []string{"", c.GetHeader(ownerHeader)}, limit,
+	).Scan(&matches).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search todos"})
+		return
+	}
+
+	results := make([]searchResult, 0, len(matches))
+	if len(matches) == 0 {
+		c.JSON(http.StatusOK, results)
+		return
+	}
+	ids := make([]uint, len(matches))
+	for i, match := range matches {
+		ids[i] = match.ID
+	}
+	var todos []models.Todo
+	if err := database.DB.Preload("Attachments.Thumbnails").Find(&todos, ids).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search todos"})
+		return
+	}
+	byID := make(map[uint]models.Todo, len(todos))
+	for _, todo := range todos {
+		byID[todo.ID] = todo
+	}
+	for _, match := range matches {
+		todo, ok := byID[match.ID]
+		if !ok {
+			// Deleted in the meantime.
+			continue
+		}
+		results = append(results, searchResult{
+			Todo: todo,
+			Rank: match.Rank,
+			Highlight: searchHighlight{
+				Title:       markMatches(match.TitleHighlight),
+				Description: markMatches(match.DescriptionHighlight),
+			},
+		})
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// markMatches escapes a ts_headline snippet for HTML and wraps the matches
+// in <mark> tags.
+func markMatches(headline string) string {
+	return strings.NewReplacer(matchStart, "<mark>", matchStop, "</mark>").Replace(html.EscapeString(headline))
+}
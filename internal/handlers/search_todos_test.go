@@ -0,0 +1,94 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/handlers"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchTodos(t *testing.T) {
+	// Setup Gin router and database
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Use real database for test
+	db := setupTestDB()
+	database.DB = db
+
+	router.GET("/todos/search", func(c *gin.Context) {
+		handlers.SearchTodos(c, db)
+	})
+
+	db.Create(&[]models.Todo{
+		{Title: "Buy groceries", Description: "Milk, eggs and <b>bread</b> from the bakery"},
+		{Title: "Bake bread", Description: "Try the sourdough recipe"},
+		{Title: "Call the plumber", Description: "The kitchen sink is leaking"},
+	})
+
+	search := func(query string) (*httptest.ResponseRecorder, []map[string]any) {
+		req, _ := http.NewRequest("GET", "/todos/search?"+query, nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		var results []map[string]any
+		json.Unmarshal(resp.Body.Bytes(), &results)
+		return resp, results
+	}
+
+	t.Run("Rank title matches first", func(t *testing.T) {
+		resp, results := search("q=bread")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Len(t, results, 2)
+		assert.Equal(t, "Bake bread", results[0]["todo"].(map[string]any)["title"])
+		assert.Greater(t, results[0]["rank"], results[1]["rank"])
+
+		// Matches are marked and everything else escaped
+		highlight := results[0]["highlight"].(map[string]any)
+		assert.Equal(t, "Bake <mark>bread</mark>", highlight["title"])
+		highlight = results[1]["highlight"].(map[string]any)
+		assert.Contains(t, highlight["description"], "&lt;b&gt;<mark>bread</mark>&lt;/b&gt;")
+	})
+
+	t.Run("Support web search syntax", func(t *testing.T) {
+		_, results := search("q=bread+-sourdough")
+		assert.Len(t, results, 1)
+		assert.Equal(t, "Buy groceries", results[0]["todo"].(map[string]any)["title"])
+
+		_, results = search("q=plumber+or+recipe")
+		assert.Len(t, results, 2)
+
+		// Words are stemmed
+		_, results = search("q=leak")
+		assert.Len(t, results, 1)
+	})
+
+	t.Run("Leave out other owners' todos", func(t *testing.T) {
+		db.Create(&models.Todo{Title: "Bread for Alice", Owner: "alice"})
+
+		_, results := search("q=bread")
+		assert.Len(t, results, 2)
+	})
+
+	t.Run("Find nothing", func(t *testing.T) {
+		resp, results := search("q=unicorn")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Empty(t, results)
+	})
+
+	t.Run("Fail without a query", func(t *testing.T) {
+		resp, _ := search("q=")
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		assert.Contains(t, resp.Body.String(), "invalid_parameter")
+
+		resp, _ = search("q=bread&limit=0")
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	truncateTable(db)
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAttachmentURLTTL  = 15 * time.Minute
+	defaultMaxFileSize       = 25 << 20
+	defaultMaxRequestSize    = 100 << 20
+	defaultMaxTodoSize       = 250 << 20
+	defaultUploadConcurrency = 3
+	defaultUploadGrace       = time.Hour
+	defaultUploadExpiry      = 24 * time.Hour
+	defaultVersionRetention  = 10
+)
+
+// attachmentURLTTL is how long presigned attachment URLs stay valid.
+var attachmentURLTTL time.Duration = defaultAttachmentURLTTL
+
+// maxFileSize caps a single uploaded file, in bytes.
+var maxFileSize int64 = defaultMaxFileSize
+
+// maxRequestSize caps the whole body of a create or update request, in bytes.
+var maxRequestSize int64 = defaultMaxRequestSize
+
+// maxTodoSize caps the combined size of one todo's attachments, in bytes.
+// Zero means unlimited.
+var maxTodoSize int64 = defaultMaxTodoSize
+
+// ownerQuota caps the combined size of all attachments of one owner, in
+// bytes. Zero means unlimited.
+var ownerQuota int64
+
+// allowedTypes and deniedTypes filter uploads by their sniffed media type.
+// Entries may end in "/*" to match a whole family, e.g. "image/*". An empty
+// allowlist allows everything not denied.
+var (
+	allowedTypes []string
+	deniedTypes  []string
+)
+
+// uploadConcurrency bounds how many uploads of one request may be in flight
+// at the same time.
+var uploadConcurrency = defaultUploadConcurrency
+
+// uploadGrace is how long a written upload may wait to be saved before its
+// object is treated as abandoned and deleted by the cleanup worker.
+var uploadGrace time.Duration = defaultUploadGrace
+
+// uploadExpiry is how long a resumable upload may take and then wait to be
+// attached before it is dropped.
+var uploadExpiry time.Duration = defaultUploadExpiry
+
+// versionRetention is how many prior versions are kept per attachment.
+// Zero keeps no history.
+var versionRetention int64 = defaultVersionRetention
+
+// requireIfMatch makes writes to a todo fail with 428 Precondition Required
+// unless If-Match names the version they were made against. Off, writes
+// without If-Match go through unchecked.
+var requireIfMatch = false
+
+// InitSettings reads the handler tunables from environment variables,
+// using the defaults for anything unset.
+func InitSettings() {
+	attachmentURLTTL = durationFromEnv("ATTACHMENT_URL_TTL", defaultAttachmentURLTTL)
+	maxFileSize = int64FromEnv("MAX_UPLOAD_FILE_SIZE", defaultMaxFileSize)
+	maxRequestSize = int64FromEnv("MAX_UPLOAD_REQUEST_SIZE", defaultMaxRequestSize)
+	uploadConcurrency = int(int64FromEnv("UPLOAD_CONCURRENCY", defaultUploadConcurrency))
+	maxTodoSize = limitFromEnv("MAX_TODO_ATTACHMENTS_SIZE", defaultMaxTodoSize)
+	ownerQuota = limitFromEnv("OWNER_STORAGE_QUOTA", 0)
+	allowedTypes = listFromEnv("ATTACHMENT_ALLOWED_TYPES")
+	deniedTypes = listFromEnv("ATTACHMENT_DENIED_TYPES")
+	uploadGrace = durationFromEnv("CLEANUP_UPLOAD_GRACE", defaultUploadGrace)
+	uploadExpiry = durationFromEnv("TUS_UPLOAD_EXPIRY", defaultUploadExpiry)
+	versionRetention = limitFromEnv("ATTACHMENT_VERSION_RETENTION", defaultVersionRetention)
+	requireIfMatch = boolFromEnv("REQUIRE_IF_MATCH", false)
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("Warning: invalid %s %q, using %s", key, value, fallback)
+		return fallback
+	}
+	return duration
+}
+
+func int64FromEnv(key string, fallback int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || number <= 0 {
+		log.Printf("Warning: invalid %s %q, using %d", key, value, fallback)
+		return fallback
+	}
+	return number
+}
+
+// limitFromEnv is like int64FromEnv but also accepts zero, which disables
+// the limit.
+func limitFromEnv(key string, fallback int64) int64 {
+	if os.Getenv(key) == "0" {
+		return 0
+	}
+	return int64FromEnv(key, fallback)
+}
+
+func boolFromEnv(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	flag, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Warning: invalid %s %q, using %t", key, value, fallback)
+		return fallback
+	}
+	return flag
+}
+
+func listFromEnv(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(strings.ToLower(item)); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -1,133 +1,559 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
-	"strings"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"todo-app/internal/database"
 	"todo-app/internal/models"
-	"todo-app/internal/s3helper"
+	"todo-app/internal/storage"
 )
 
+// GetTodos lists the requester's todos and those without an owner a page
+// at a time, filtered and sorted as described at parseTodoQuery. The body is the array of todos on the page; a Link
+// header points at the next page, and X-Total-Count holds the number of
+// matching todos when the request asks for it.
+//
+//	@Summary	List todos
+//	@Tags		todos
+//	@Produce	json
+//	@Param		X-Owner-ID			header		string	false	"Owner whose todos to list, next to those without an owner"
+//	@Param		limit				query		int		false	"Todos per page"	minimum(1)	maximum(200)	default(50)
+//	@Param		cursor				query		string	false	"Where to continue, from the Link header of the previous page"
+//	@Param		sort				query		string	false	"Sort column, prefixed with - for descending order"	Enums(id, -id, title, -title, created_at, -created_at, updated_at, -updated_at)
+//	@Param		title				query		string	false	"Case-insensitive substring of the title"
+//	@Param		description			query		string	false	"Case-insensitive substring of the description"
+//	@Param		completed			query		bool	false	"Only done or only open todos"
+//	@Param		created_since		query		string	false	"RFC 3339 timestamp or date, inclusive"
+//	@Param		created_before		query		string	false	"RFC 3339 timestamp or date, exclusive"
+//	@Param		updated_since		query		string	false	"RFC 3339 timestamp or date, inclusive"
+//	@Param		updated_before		query		string	false	"RFC 3339 timestamp or date, exclusive"
+//	@Param		completed_since		query		string	false	"RFC 3339 timestamp or date, inclusive"
+//	@Param		completed_before	query		string	false	"RFC 3339 timestamp or date, exclusive"
+//	@Param		count				query		bool	false	"Report the number of matching todos in X-Total-Count"
+//	@Success	200					{array}		models.Todo
+//	@Header		200					{string}	Link			"Next page, if any"
+//	@Header		200					{integer}	X-Total-Count	"Number of matching todos, if asked for"
+//	@Header		200					{string}	ETag			"Version of the page"
+//	@Success	304
+//	@Failure	400					{object}	errorResponse
+//	@Router		/todos [get]
 func GetTodos(c *gin.Context, db *gorm.DB) {
-	var todos []models.Todo
-	database.DB.Find(&todos)
-	c.JSON(http.StatusOK, todos)
+	params, err := parseTodoQuery(c)
+	if err != nil {
+		respondError(c, err, "Failed to load todos")
+		return
+	}
+	if params.count {
+		var total int64
+		if err := params.filter(database.DB.Model(&models.Todo{})).Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load todos"})
+			return
+		}
+		c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	}
+	todos := []models.Todo{}
+	query := params.page(params.filter(database.DB.Preload("Attachments.Thumbnails")))
+	if err := query.Find(&todos).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load todos"})
+		return
+	}
+	if len(todos) > params.limit {
+		todos = todos[:params.limit]
+		c.Header("Link", nextLink(c.Request.URL, params.nextCursor(todos[len(todos)-1])))
+	}
+	respondTagged(c, http.StatusOK, todos)
 }
 
+// GetTodoByID returns a todo with its attachments. The ETag it comes with
+// is what writes to the todo send in If-Match; sent in If-None-Match, it
+// gets a 304 Not Modified while the todo is unchanged.
+//
+//	@Summary	Get a todo
+//	@Tags		todos
+//	@Produce	json
+//	@Param		id				path		int		true	"Todo ID"
+//	@Param		X-Owner-ID		header		string	false	"Owner of the todo"
+//	@Param		If-None-Match	header		string	false	"ETag of the copy at hand"
+//	@Success	200				{object}	models.Todo
+//	@Header		200				{string}	ETag	"Version of the todo"
+//	@Success	304
+//	@Failure	400	{object}	errorResponse
+//	@Failure	403	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Router		/todos/{id} [get]
 func GetTodoByID(c *gin.Context, db *gorm.DB) {
+	todo, ok := findOwnedTodo(c, "Attachments.Thumbnails")
+	if !ok {
+		return
+	}
+	respondTodo(c, http.StatusOK, &todo)
+}
+
+// CreateTodo adds a todo owned by the requester. The body is either JSON,
+// see todoRequest, or a multipart form with the same fields as text fields
+// and any number of "files" parts to attach.
+//
+//	@Summary		Create a todo
+//	@Description	Send application/json with the todo, or multipart/form-data with the same fields as text fields and files to attach.
+//	@Tags			todos
+//	@Accept			json,mpfd
+//	@Produce		json
+//	@Param			X-Owner-ID	header		string		false	"Owner of the todo"
+//	@Param			todo		body		todoRequest	false	"The todo, for application/json"
+//	@Param			title		formData	string		false	"Title, for multipart/form-data"
+//	@Param			description	formData	string		false	"Description, for multipart/form-data"
+//	@Param			completed	formData	bool		false	"Whether the todo is done, for multipart/form-data"
+//	@Param			files		formData	file		false	"Files to attach, for multipart/form-data"
+//	@Success		201			{object}	models.Todo
+//	@Failure		400			{object}	errorResponse
+//	@Failure		413			{object}	errorResponse
+//	@Failure		422			{object}	errorResponse
+//	@Failure		503			{object}	errorResponse
+//	@Router			/todos [post]
+func CreateTodo(c *gin.Context, db *gorm.DB, store storage.Storage) {
 	var todo models.Todo
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 32)
+	// Reserve the ID up front so uploads can be keyed by it while the
+	// request is still streaming in.
+	id, err := reserveTodoID()
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create todo"})
 		return
 	}
-	if err := database.DB.First(&todo, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+	owner := c.GetHeader(ownerHeader)
+	budget, err := newUploadBudget(owner, 0, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create todo"})
 		return
 	}
-	c.JSON(http.StatusOK, todo)
+	fields, attachments, err := readTodoRequest(c, store, id, budget)
+	if err != nil {
+		respondError(c, err, "Failed to create todo")
+		return
+	}
+	todo.ID = id
+	todo.Owner = owner
+	fields.apply(&todo)
+	uploaded := attachmentKeys(attachments)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := commitUploads(tx, attachments); err != nil {
+			return err
+		}
+		if err := tx.Create(&todo).Error; err != nil {
+			return err
+		}
+		todo.Attachments, err = saveAttachments(tx, todo.ID, attachments)
+		return err
+	})
+	if err != nil {
+		abandonUploads(uploaded)
+		respondError(c, err, "Failed to create todo")
+		return
+	}
+	respondSavedTodo(c, http.StatusCreated, todo.ID)
 }
 
-func CreateTodo(c *gin.Context, db *gorm.DB) {
-	var todo models.Todo
-	todo.Title = c.PostForm("title")
-	todo.Description = c.PostForm("description")
-	var attachmentURLs []string
-	form, err := c.MultipartForm()
+// UpdateTodo replaces a todo with the one sent, as JSON or as a multipart
+// form like CreateTodo takes. Like any full
+// replacement, fields left out are reset: the title is required, a missing
+// description is empty and a missing completed false. Attachments are only
+// replaced when files are sent; they have their own routes otherwise. The
+// request names the version it replaces in If-Match, see checkIfMatch.
+//
+//	@Summary		Replace a todo
+//	@Description	Send application/json with the todo, or multipart/form-data with the same fields as text fields and files replacing the attachments.
+//	@Tags			todos
+//	@Accept			json,mpfd
+//	@Produce		json
+//	@Param			id			path		int			true	"Todo ID"
+//	@Param			X-Owner-ID	header		string		false	"Owner of the todo"
+//	@Param			If-Match	header		string		false	"ETag of the todo being replaced, required when REQUIRE_IF_MATCH is on"
+//	@Param			todo		body		todoRequest	false	"The todo, for application/json"
+//	@Param			title		formData	string		false	"Title, for multipart/form-data"
+//	@Param			description	formData	string		false	"Description, for multipart/form-data"
+//	@Param			completed	formData	bool		false	"Whether the todo is done, for multipart/form-data"
+//	@Param			files		formData	file		false	"Files replacing the attachments, for multipart/form-data"
+//	@Success		200			{object}	models.Todo
+//	@Failure		400			{object}	errorResponse
+//	@Failure		403			{object}	errorResponse
+//	@Failure		404			{object}	errorResponse
+//	@Failure		412			{object}	errorResponse
+//	@Failure		413			{object}	errorResponse
+//	@Failure		422			{object}	errorResponse
+//	@Failure		428			{object}	errorResponse
+//	@Failure		503			{object}	errorResponse
+//	@Router			/todos/{id} [put]
+func UpdateTodo(c *gin.Context, db *gorm.DB, store storage.Storage) {
+	todo, ok := findOwnedTodo(c, "Attachments.Thumbnails")
+	if !ok {
+		return
+	}
+	if !checkIfMatch(c, &todo) {
+		return
+	}
+	// Files sent with an update replace the current ones, so those don't
+	// count against the budget.
+	budget, err := newUploadBudget(todo.Owner, 0, attachmentsSize(todo.Attachments))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update todo"})
 		return
 	}
-	files := form.File["files"]
-	if len(files) > 0 {
-		for _, file := range files {
-			openedFile, openErr := file.Open()
-			if openErr != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
-				return
-			}
-			defer openedFile.Close()
-			fileURL, uploadErr := s3helper.UploadFile(openedFile, file.Filename)
-			if uploadErr != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "File upload failed"})
-				return
+	fields, attachments, err := readTodoRequest(c, store, todo.ID, budget)
+	if err != nil {
+		respondError(c, err, "Failed to update todo")
+		return
+	}
+	fields.apply(&todo)
+	// Files sent with an update replace the current attachments. Those
+	// named like a new file get it as their new version, the rest go.
+	var replaced []models.Attachment
+	if len(attachments) > 0 {
+		names := make(map[string]bool, len(attachments))
+		for _, attachment := range attachments {
+			names[attachment.OriginalFilename] = true
+		}
+		for _, attachment := range todo.Attachments {
+			if !names[attachment.OriginalFilename] {
+				replaced = append(replaced, attachment)
 			}
-			attachmentURLs = append(attachmentURLs, fileURL)
 		}
-		todo.Attachment = strings.Join(attachmentURLs, ",")
 	}
-	if err := database.DB.Create(&todo).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create todo"})
+	uploaded := attachmentKeys(attachments)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Claim the new uploads before releasing the old ones, so content
+		// that is re-uploaded keeps its existing object.
+		if err := commitUploads(tx, attachments); err != nil {
+			return err
+		}
+		if len(replaced) > 0 {
+			if err := releaseAttachments(tx, replaced); err != nil {
+				return err
+			}
+			if err := tx.Delete(&replaced).Error; err != nil {
+				return err
+			}
+		}
+		if len(attachments) > 0 {
+			saved, err := saveAttachments(tx, todo.ID, attachments)
+			if err != nil {
+				return err
+			}
+			todo.Attachments = saved
+		}
+		return saveTodoColumns(tx, &todo, "title", "description", "completed", "completed_at")
+	})
+	if err != nil {
+		abandonUploads(uploaded)
+		respondError(c, err, "Failed to update todo")
 		return
 	}
-	c.JSON(http.StatusCreated, todo)
+	respondSavedTodo(c, http.StatusOK, todo.ID)
 }
 
-func UpdateTodo(c *gin.Context, db *gorm.DB) {
-	var todo models.Todo
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 32)
+// PatchTodo changes only the fields of a todo a patch names. The body is
+// a JSON Merge Patch (RFC 7396), taken for plain JSON too, or a JSON Patch
+// (RFC 6902), told apart by the Content-Type. Either applies to the todo
+// as {"title", "description", "completed"}; the result must be as valid as
+// a todo sent with PUT. If-Match applies as for PUT.
+//
+//	@Summary	Change some fields of a todo
+//	@Tags		todos
+//	@Accept		application/merge-patch+json,application/json-patch+json,json
+//	@Produce	json
+//	@Param		id			path		int		true	"Todo ID"
+//	@Param		X-Owner-ID	header		string	false	"Owner of the todo"
+//	@Param		If-Match	header		string	false	"ETag of the todo being changed, required when REQUIRE_IF_MATCH is on"
+//	@Param		patch		body		object	true	"JSON Merge Patch or JSON Patch of the todo's title, description and completed"
+//	@Success	200			{object}	models.Todo
+//	@Failure	400			{object}	errorResponse
+//	@Failure	403			{object}	errorResponse
+//	@Failure	404			{object}	errorResponse
+//	@Failure	409			{object}	errorResponse
+//	@Failure	412			{object}	errorResponse
+//	@Failure	415			{object}	errorResponse
+//	@Failure	422			{object}	errorResponse
+//	@Failure	428			{object}	errorResponse
+//	@Router		/todos/{id} [patch]
+func PatchTodo(c *gin.Context, db *gorm.DB) {
+	todo, ok := findOwnedTodo(c, "Attachments.Thumbnails")
+	if !ok {
+		return
+	}
+	if !checkIfMatch(c, &todo) {
+		return
+	}
+	c.Header("Accept-Patch", mergePatchType+", "+jsonPatchType)
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxJSONSize+1))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read patch"})
 		return
 	}
-	todo.ID = uint(id)
-	if err := database.DB.First(&todo, todo.ID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+	if len(body) > maxJSONSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Patch too large"})
 		return
 	}
-	todo.Title = c.PostForm("title")
-	todo.Description = c.PostForm("description")
-	var attachmentURLs []string
-	form, err := c.MultipartForm()
+	fields, changed, err := patchTodoFields(todo, mediaType, body)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
+		respondError(c, err, "Failed to update todo")
 		return
 	}
-	files := form.File["files"]
-	if len(files) > 0 {
-		if todo.Attachment != "" {
-			oldFiles := strings.Split(todo.Attachment, ",")
-			for _, oldFile := range oldFiles {
-				fileName := strings.Split(oldFile, "/")[len(strings.Split(oldFile, "/"))-1]
-				s3helper.DeleteFile(fileName)
-			}
+	if len(changed) == 0 {
+		respondTodo(c, http.StatusOK, &todo)
+		return
+	}
+	fields.apply(&todo)
+	if err := saveTodoColumns(database.DB, &todo, changed...); err != nil {
+		respondError(c, err, "Failed to update todo")
+		return
+	}
+	respondSavedTodo(c, http.StatusOK, todo.ID)
+}
+
+// DeleteTodo deletes a todo and releases the content of its attachments.
+// If-Match applies as for PUT.
+//
+//	@Summary	Delete a todo
+//	@Tags		todos
+//	@Produce	json
+//	@Param		id			path		int		true	"Todo ID"
+//	@Param		X-Owner-ID	header		string	false	"Owner of the todo"
+//	@Param		If-Match	header		string	false	"ETag of the todo being deleted, required when REQUIRE_IF_MATCH is on"
+//	@Success	200			{object}	map[string]string
+//	@Failure	400			{object}	errorResponse
+//	@Failure	403			{object}	errorResponse
+//	@Failure	404			{object}	errorResponse
+//	@Failure	412			{object}	errorResponse
+//	@Failure	428			{object}	errorResponse
+//	@Router		/todos/{id} [delete]
+func DeleteTodo(c *gin.Context, db *gorm.DB, store storage.Storage) {
+	todo, ok := findOwnedTodo(c, "Attachments.Thumbnails")
+	if !ok {
+		return
+	}
+	if !checkIfMatch(c, &todo) {
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := releaseAttachments(tx, todo.Attachments); err != nil {
+			return err
+		}
+		result := tx.Where("version = ?", todo.Version).Select("Attachments").Delete(&todo)
+		if result.Error == nil && result.RowsAffected == 0 {
+			return errTodoChanged
+		}
+		return result.Error
+	})
+	if err != nil {
+		respondError(c, err, "Failed to delete todo")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Todo deleted"})
+}
+
+// CloneTodo copies a todo into a new one owned by the requester. The body
+// is optional: fields picks what to carry over out of title, description
+// and completed (title and description by default), and attachments picks
+// attachments by ID (all of them by default). Attachments keep their
+// content and thumbnails but start a new version history. The same rules
+// as for uploads apply to them.
+//
+//	@Summary	Clone a todo
+//	@Tags		todos
+//	@Accept		json
+//	@Produce	json
+//	@Param		id			path		int				true	"Todo ID"
+//	@Param		X-Owner-ID	header		string			false	"Owner of the source todo and of the clone"
+//	@Param		clone		body		cloneRequest	false	"Fields and attachments to carry over"
+//	@Success	201			{object}	models.Todo
+//	@Failure	400			{object}	errorResponse
+//	@Failure	403			{object}	errorResponse
+//	@Failure	404			{object}	errorResponse
+//	@Failure	409			{object}	errorResponse
+//	@Failure	413			{object}	errorResponse
+//	@Failure	415			{object}	errorResponse
+//	@Failure	422			{object}	errorResponse
+//	@Failure	503			{object}	errorResponse
+//	@Router		/todos/{id}/clone [post]
+func CloneTodo(c *gin.Context, db *gorm.DB, store storage.Storage) {
+	source, ok := findOwnedTodo(c)
+	if !ok {
+		return
+	}
+	var request cloneRequest
+	if err := c.ShouldBindJSON(&request); err != nil && c.Request.ContentLength != 0 && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if request.Fields == nil {
+		request.Fields = []string{"title", "description"}
+	}
+	clone := models.Todo{Owner: c.GetHeader(ownerHeader)}
+	for _, field := range request.Fields {
+		switch field {
+		case "title":
+			clone.Title = source.Title
+		case "description":
+			clone.Description = source.Description
+		case "completed":
+			clone.Completed = source.Completed
+			clone.CompletedAt = source.CompletedAt
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown field %q", field)})
+			return
+		}
+	}
+
+	var attachments []models.Attachment
+	if err := database.DB.Preload("Thumbnails").Where("todo_id = ?", source.ID).Order("id").Find(&attachments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clone todo"})
+		return
+	}
+	if request.Attachments != nil {
+		byID := make(map[uint]models.Attachment, len(attachments))
+		for _, attachment := range attachments {
+			byID[attachment.ID] = attachment
 		}
-		for _, file := range files {
-			openedFile, _ := file.Open()
-			defer openedFile.Close()
-			fileURL, uploadErr := s3helper.UploadFile(openedFile, file.Filename)
-			if uploadErr != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "File upload failed"})
+		picked := make(map[uint]bool, len(*request.Attachments))
+		attachments = attachments[:0]
+		for _, id := range *request.Attachments {
+			attachment, ok := byID[id]
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Attachment %d does not belong to the todo", id)})
 				return
 			}
-			attachmentURLs = append(attachmentURLs, fileURL)
+			if !picked[id] {
+				picked[id] = true
+				attachments = append(attachments, attachment)
+			}
 		}
-		todo.Attachment = strings.Join(attachmentURLs, ",")
 	}
-	if err := database.DB.Save(&todo).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update todo"})
+	budget, err := newUploadBudget(clone.Owner, 0, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clone todo"})
+		return
+	}
+	for _, attachment := range attachments {
+		if attachment.ScanStatus == models.ScanInfected {
+			respondError(c, malwareError(attachment.OriginalFilename, ""), "Failed to clone todo")
+			return
+		}
+		mediaType, _, _ := mime.ParseMediaType(attachment.ContentType)
+		if !contentTypeAllowed(mediaType) {
+			respondError(c, unsupportedTypeError(attachment.OriginalFilename, mediaType), "Failed to clone todo")
+			return
+		}
+		if limit, limitErr := budget.limitFor(attachment.OriginalFilename); attachment.Size > limit {
+			respondError(c, limitErr, "Failed to clone todo")
+			return
+		}
+		budget.spend(attachment.Size)
+	}
+
+	clone.ID, err = reserveTodoID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clone todo"})
+		return
+	}
+	clones, copied, err := cloneAttachments(c.Request.Context(), store, clone.ID, attachments)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clone todo"})
+		return
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := commitClones(tx, clones, copied); err != nil {
+			return err
+		}
+		clone.Attachments = clones
+		return tx.Create(&clone).Error
+	})
+	if err != nil {
+		abandonUploads(copied)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attachments changed while cloning"})
+		return
+	}
+	if err != nil {
+		respondError(c, err, "Failed to clone todo")
 		return
 	}
-	c.JSON(http.StatusOK, todo)
+	// Reload for the thumbnail URLs.
+	respondSavedTodo(c, http.StatusCreated, clone.ID)
 }
 
-func DeleteTodo(c *gin.Context, db *gorm.DB) {
-	var todo models.Todo
-	id := c.Param("id")
-	if err := database.DB.First(&todo, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Todo not found"})
+// CompleteTodo marks a todo as done. Completing a completed todo leaves it
+// as it is.
+//
+//	@Summary	Complete a todo
+//	@Tags		todos
+//	@Produce	json
+//	@Param		id			path		int		true	"Todo ID"
+//	@Param		X-Owner-ID	header		string	false	"Owner of the todo"
+//	@Success	200			{object}	models.Todo
+//	@Failure	400			{object}	errorResponse
+//	@Failure	403			{object}	errorResponse
+//	@Failure	404			{object}	errorResponse
+//	@Failure	412			{object}	errorResponse
+//	@Router		/todos/{id}/complete [post]
+func CompleteTodo(c *gin.Context, db *gorm.DB) {
+	setTodoCompleted(c, true)
+}
+
+// ReopenTodo marks a todo as not done. Reopening an open todo leaves it as
+// it is.
+//
+//	@Summary	Reopen a todo
+//	@Tags		todos
+//	@Produce	json
+//	@Param		id			path		int		true	"Todo ID"
+//	@Param		X-Owner-ID	header		string	false	"Owner of the todo"
+//	@Success	200			{object}	models.Todo
+//	@Failure	400			{object}	errorResponse
+//	@Failure	403			{object}	errorResponse
+//	@Failure	404			{object}	errorResponse
+//	@Failure	412			{object}	errorResponse
+//	@Router		/todos/{id}/reopen [post]
+func ReopenTodo(c *gin.Context, db *gorm.DB) {
+	setTodoCompleted(c, false)
+}
+
+// setTodoCompleted flips the completion state of the todo named by the :id
+// param, stamping CompletedAt when it is marked done and clearing it on reopen.
+func setTodoCompleted(c *gin.Context, completed bool) {
+	todo, ok := findOwnedTodo(c, "Attachments.Thumbnails")
+	if !ok {
+		return
+	}
+	if todo.Completed == completed {
+		respondTodo(c, http.StatusOK, &todo)
 		return
 	}
-	if todo.Attachment != "" {
-		fileName := strings.Split(todo.Attachment, "/")[len(strings.Split(todo.Attachment, "/"))-1]
-		s3helper.DeleteFile(fileName)
+	setCompleted(&todo, completed)
+	if err := saveTodoColumns(database.DB, &todo, "completed", "completed_at"); err != nil {
+		respondError(c, err, "Failed to update todo")
+		return
 	}
-	database.DB.Delete(&todo)
-	c.JSON(http.StatusOK, gin.H{"message": "Todo deleted"})
+	respondSavedTodo(c, http.StatusOK, todo.ID)
+}
+
+// reserveTodoID takes the next ID from the todos sequence without inserting
+// a row.
+func reserveTodoID() (uint, error) {
+	var id uint
+	err := database.DB.Raw("SELECT nextval(pg_get_serial_sequence('todos', 'id'))").Scan(&id).Error
+	return id, err
+}
+
+// reserveIDs takes n IDs from the sequence of table without inserting rows.
+func reserveIDs(table string, n int) ([]uint, error) {
+	var ids []uint
+	err := database.DB.Raw("SELECT nextval(pg_get_serial_sequence(?, 'id')) FROM generate_series(1, ?)", table, n).Scan(&ids).Error
+	return ids, err
 }
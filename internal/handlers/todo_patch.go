@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"todo-app/internal/models"
+)
+
+// Media types PATCH accepts. Plain JSON is taken as a merge patch.
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// maxJSONSize caps JSON request bodies: room for a title and a description
+// of the largest size a form accepts.
+const maxJSONSize = 3 * maxFieldSize
+
+var (
+	errInvalidPatch     = &requestError{Status: http.StatusBadRequest, Message: "Invalid patch document", Code: "invalid_patch"}
+	errUnsupportedPatch = &requestError{
+		Status:  http.StatusUnsupportedMediaType,
+		Message: fmt.Sprintf("Unsupported patch format, use %s or %s", mergePatchType, jsonPatchType),
+		Code:    "unsupported_media_type",
+	}
+)
+
+// todoFields are the fields of a todo clients write directly. Everything
+// else is either maintained by the server or, like attachments, changed
+// through its own routes.
+type todoFields struct {
+	Title       string
+	Description string
+	Completed   bool
+}
+
+// invalidField reports a todo field that can't take the value sent.
+func invalidField(name string, message string) *requestError {
+	return &requestError{
+		Status:  http.StatusUnprocessableEntity,
+		Message: message,
+		Code:    "invalid_field",
+		Details: gin.H{"field": name},
+	}
+}
+
+// validate checks fields about to be written to a todo.
+func (f todoFields) validate() error {
+	if strings.TrimSpace(f.Title) == "" {
+		return invalidField("title", "Title must not be empty")
+	}
+	if len(f.Title) > maxFieldSize {
+		return invalidField("title", fmt.Sprintf("Title must not exceed %d bytes", maxFieldSize))
+	}
+	if len(f.Description) > maxFieldSize {
+		return invalidField("description", fmt.Sprintf("Description must not exceed %d bytes", maxFieldSize))
+	}
+	return nil
+}
+
+// apply writes fields to todo, stamping or clearing CompletedAt when the
+// completion state changes.
+func (f todoFields) apply(todo *models.Todo) {
+	todo.Title = f.Title
+	todo.Description = f.Description
+	setCompleted(todo, f.Completed)
+}
+
+// setCompleted marks todo done or open. CompletedAt is stamped when it is
+// marked done and cleared on reopen.
+func setCompleted(todo *models.Todo, completed bool) {
+	if todo.Completed == completed {
+		return
+	}
+	todo.Completed = completed
+	todo.CompletedAt = nil
+	if completed {
+		now := time.Now()
+		todo.CompletedAt = &now
+	}
+}
+
+// replacementFields reads the fields of a form replacing a todo. The title
+// is required; a missing description is empty and a missing completed
+// false, as in any full replacement.
+func (f *todoForm) replacementFields() (todoFields, error) {
+	title, ok := f.values["title"]
+	if !ok {
+		return todoFields{}, invalidField("title", "Title is required")
+	}
+	fields := todoFields{Title: title, Description: f.values["description"]}
+	if value, ok := f.values["completed"]; ok {
+		completed, err := strconv.ParseBool(value)
+		if err != nil {
+			return todoFields{}, invalidField("completed", "Completed must be true or false")
+		}
+		fields.Completed = completed
+	}
+	return fields, fields.validate()
+}
+
+// patchTodoFields applies a PATCH body of the given media type to the
+// fields of todo. It returns the patched fields and the names of those the
+// patch changed.
+func patchTodoFields(todo models.Todo, mediaType string, body []byte) (todoFields, []string, error) {
+	document := map[string]any{
+		"title":       todo.Title,
+		"description": todo.Description,
+		"completed":   todo.Completed,
+	}
+	var err error
+	switch mediaType {
+	case mergePatchType, "application/json":
+		document, err = applyMergePatch(document, body)
+	case jsonPatchType:
+		document, err = applyJSONPatch(document, body)
+	default:
+		err = errUnsupportedPatch
+	}
+	if err != nil {
+		return todoFields{}, nil, err
+	}
+
+	// Members the patch removed fall back to their zero value, except for
+	// the title, which is required.
+	var fields todoFields
+	for name, value := range document {
+		var ok bool
+		switch name {
+		case "title":
+			fields.Title, ok = value.(string)
+		case "description":
+			fields.Description, ok = value.(string)
+		case "completed":
+			fields.Completed, ok = value.(bool)
+		default:
+			return todoFields{}, nil, invalidField(name, fmt.Sprintf("Field %q cannot be changed", name))
+		}
+		if !ok {
+			return todoFields{}, nil, invalidField(name, fmt.Sprintf("Field %q has the wrong type", name))
+		}
+	}
+	if _, ok := document["title"]; !ok {
+		return todoFields{}, nil, invalidField("title", "Title is required")
+	}
+	if err := fields.validate(); err != nil {
+		return todoFields{}, nil, err
+	}
+
+	var changed []string
+	if fields.Title != todo.Title {
+		changed = append(changed, "title")
+	}
+	if fields.Description != todo.Description {
+		changed = append(changed, "description")
+	}
+	if fields.Completed != todo.Completed {
+		changed = append(changed, "completed", "completed_at")
+	}
+	return fields, changed, nil
+}
+
+// applyMergePatch applies a JSON Merge Patch (RFC 7396) to document.
+// Members set to null are removed, all others replaced.
+func applyMergePatch(document map[string]any, body []byte) (map[string]any, error) {
+	var patch map[string]any
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		return nil, errInvalidPatch
+	}
+	for name, value := range patch {
+		if value == nil {
+			delete(document, name)
+		} else {
+			document[name] = value
+		}
+	}
+	return document, nil
+}
+
+// jsonPatchOperation is one operation of a JSON Patch document.
+type jsonPatchOperation struct {
+	Op    string           `json:"op"`
+	Path  *string          `json:"path"`
+	From  *string          `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch applies a JSON Patch (RFC 6902) to document. The
+// operations apply in order and all or none take effect. Todos have no
+// nested members, so paths point at a top level member or, for add and
+// replace, at the whole document.
+func applyJSONPatch(document map[string]any, body []byte) (map[string]any, error) {
+	var operations []jsonPatchOperation
+	if err := json.Unmarshal(body, &operations); err != nil {
+		return nil, errInvalidPatch
+	}
+	for i, operation := range operations {
+		if operation.Path == nil {
+			return nil, operationError(i, "is missing a path")
+		}
+		name, whole, err := parsePointer(*operation.Path)
+		if err != nil {
+			return nil, operationError(i, err.Error())
+		}
+		var value any
+		switch operation.Op {
+		case "add", "replace", "test":
+			if operation.Value == nil {
+				return nil, operationError(i, "is missing a value")
+			}
+			if err := json.Unmarshal(*operation.Value, &value); err != nil {
+				return nil, operationError(i, "has an invalid value")
+			}
+		case "move", "copy":
+			if operation.From == nil {
+				return nil, operationError(i, "is missing from")
+			}
+			from, fromWhole, err := parsePointer(*operation.From)
+			if err != nil || fromWhole {
+				return nil, operationError(i, "has an invalid from")
+			}
+			var ok bool
+			if value, ok = document[from]; !ok {
+				return nil, patchFailed(i, fmt.Sprintf("%s does not exist", *operation.From))
+			}
+			if operation.Op == "move" {
+				delete(document, from)
+			}
+		case "remove":
+		default:
+			return nil, operationError(i, fmt.Sprintf("has an unknown op %q", operation.Op))
+		}
+
+		if whole {
+			replacement, ok := value.(map[string]any)
+			if (operation.Op != "add" && operation.Op != "replace") || !ok {
+				return nil, patchFailed(i, "the document can only be replaced by an object")
+			}
+			document = replacement
+			continue
+		}
+		current, exists := document[name]
+		switch operation.Op {
+		case "remove", "replace", "test":
+			if !exists {
+				return nil, patchFailed(i, fmt.Sprintf("%s does not exist", *operation.Path))
+			}
+		}
+		switch operation.Op {
+		case "remove":
+			delete(document, name)
+		case "test":
+			if !reflect.DeepEqual(current, value) {
+				return nil, &requestError{
+					Status:  http.StatusConflict,
+					Message: fmt.Sprintf("Test of %s failed", *operation.Path),
+					Code:    "test_failed",
+					Details: gin.H{"operation": i},
+				}
+			}
+		default:
+			document[name] = value
+		}
+	}
+	return document, nil
+}
+
+// parsePointer resolves a JSON Pointer (RFC 6901) into the name of a top
+// level member, or reports that it points at the whole document.
+func parsePointer(pointer string) (string, bool, error) {
+	if pointer == "" {
+		return "", true, nil
+	}
+	if !strings.HasPrefix(pointer, "/") || strings.Contains(pointer[1:], "/") {
+		return "", false, fmt.Errorf("has an unsupported path %q", pointer)
+	}
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(pointer[1:]), false, nil
+}
+
+// operationError reports a malformed operation of a JSON Patch.
+func operationError(index int, problem string) *requestError {
+	return &requestError{
+		Status:  http.StatusBadRequest,
+		Message: fmt.Sprintf("Operation %d %s", index, problem),
+		Code:    "invalid_patch",
+		Details: gin.H{"operation": index},
+	}
+}
+
+// patchFailed reports an operation of a JSON Patch that can't be applied to
+// the todo.
+func patchFailed(index int, problem string) *requestError {
+	return &requestError{
+		Status:  http.StatusUnprocessableEntity,
+		Message: fmt.Sprintf("Operation %d failed: %s", index, problem),
+		Code:    "patch_failed",
+		Details: gin.H{"operation": index},
+	}
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"todo-app/internal/models"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// todoSorts are the columns todos can be sorted by. Ties are broken by ID,
+// so every order is stable and pages never overlap.
+var todoSorts = []string{"id", "title", "created_at", "updated_at"}
+
+// todoDateFilters are the date range parameters of a todo listing. Lower
+// bounds are inclusive, upper bounds exclusive.
+var todoDateFilters = []struct {
+	param     string
+	condition string
+}{
+	{"created_since", "created_at >= ?"},
+	{"created_before", "created_at < ?"},
+	{"updated_since", "updated_at >= ?"},
+	{"updated_before", "updated_at < ?"},
+	{"completed_since", "completed_at >= ?"},
+	{"completed_before", "completed_at < ?"},
+}
+
+// todoQuery is a parsed request for a page of todos.
+type todoQuery struct {
+	limit      int
+	sort       string
+	column     string
+	descending bool
+	count      bool
+	cursor     *todoCursor
+	// after is the sort key of the cursor, unless sorting by ID.
+	after      any
+	conditions []condition
+}
+
+// condition is a WHERE clause with its arguments.
+type condition struct {
+	sql  string
+	args []any
+}
+
+// todoCursor marks where a page ended: the sort it belongs to and the sort
+// key and ID of the last todo on it. Clients get it opaque, as base64 of
+// its JSON.
+type todoCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v,omitempty"`
+	ID    uint   `json:"id"`
+}
+
+// invalidParameter reports a query parameter that could not be used.
+func invalidParameter(name string, message string) *requestError {
+	return &requestError{
+		Status:  http.StatusBadRequest,
+		Message: message,
+		Code:    "invalid_parameter",
+		Details: gin.H{"parameter": name},
+	}
+}
+
+// parseTodoQuery reads the parameters of a todo listing:
+//
+//   - limit: todos per page, 1 to maxPageLimit
+//   - cursor: where to continue, as handed out in the previous Link header
+//   - sort: one of todoSorts, prefixed with "-" for descending order
+//   - title, description: case-insensitive substrings to look for
+//   - completed: true or false
+//   - created_since, created_before and the like: RFC 3339 timestamps or
+//     plain dates, see todoDateFilters
+//   - count: true to report the number of matching todos
+func parseTodoQuery(c *gin.Context) (*todoQuery, error) {
+	query := &todoQuery{limit: defaultPageLimit, sort: "id", column: "id", conditions: []condition{ownedTodos(c)}}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return nil, invalidParameter("limit", fmt.Sprintf("Invalid limit, must be between 1 and %d", maxPageLimit))
+		}
+		query.limit = limit
+	}
+	if value := c.Query("sort"); value != "" {
+		query.sort = value
+		query.column, query.descending = strings.CutPrefix(value, "-")
+		if !slices.Contains(todoSorts, query.column) {
+			return nil, invalidParameter("sort", fmt.Sprintf("Invalid sort, must be one of %s, optionally prefixed with -", strings.Join(todoSorts, ", ")))
+		}
+	}
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodeTodoCursor(value)
+		if err != nil || cursor.Sort != query.sort {
+			return nil, invalidParameter("cursor", "Invalid cursor")
+		}
+		query.cursor = cursor
+		switch query.column {
+		case "title":
+			query.after = cursor.Value
+		case "created_at", "updated_at":
+			if query.after, err = time.Parse(time.RFC3339Nano, cursor.Value); err != nil {
+				return nil, invalidParameter("cursor", "Invalid cursor")
+			}
+		}
+	}
+	if value := c.Query("count"); value != "" {
+		count, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, invalidParameter("count", "Invalid count, must be true or false")
+		}
+		query.count = count
+	}
+
+	for _, field := range []string{"title", "description"} {
+		if value := c.Query(field); value != "" {
+			query.conditions = append(query.conditions, condition{field + " ILIKE ?", []any{"%" + escapeLike(value) + "%"}})
+		}
+	}
+	if value := c.Query("completed"); value != "" {
+		completed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, invalidParameter("completed", "Invalid completed filter")
+		}
+		query.conditions = append(query.conditions, condition{"completed = ?", []any{completed}})
+	}
+	for _, filter := range todoDateFilters {
+		value := c.Query(filter.param)
+		if value == "" {
+			continue
+		}
+		date, err := parseDateParam(value)
+		if err != nil {
+			return nil, invalidParameter(filter.param, fmt.Sprintf("Invalid %s, must be an RFC 3339 timestamp or a date", filter.param))
+		}
+		query.conditions = append(query.conditions, condition{filter.condition, []any{date}})
+	}
+	return query, nil
+}
+
+// filter restricts db to the todos matching the query, on any page.
+func (q *todoQuery) filter(db *gorm.DB) *gorm.DB {
+	for _, cond := range q.conditions {
+		db = db.Where(cond.sql, cond.args...)
+	}
+	return db
+}
+
+// page restricts db to the page the query asks for, plus one todo to tell
+// whether there is a next page.
+func (q *todoQuery) page(db *gorm.DB) *gorm.DB {
+	direction, comparison := "ASC", ">"
+	if q.descending {
+		direction, comparison = "DESC", "<"
+	}
+	if q.cursor != nil {
+		if q.column == "id" {
+			db = db.Where("id "+comparison+" ?", q.cursor.ID)
+		} else {
+			db = db.Where("("+q.column+", id) "+comparison+" (?, ?)", q.after, q.cursor.ID)
+		}
+	}
+	if q.column != "id" {
+		db = db.Order(q.column + " " + direction)
+	}
+	return db.Order("id " + direction).Limit(q.limit + 1)
+}
+
+// nextCursor returns the cursor continuing after todo, the last one on the
+// current page.
+func (q *todoQuery) nextCursor(todo models.Todo) string {
+	cursor := todoCursor{Sort: q.sort, ID: todo.ID}
+	switch q.column {
+	case "title":
+		cursor.Value = todo.Title
+	case "created_at":
+		cursor.Value = todo.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		cursor.Value = todo.UpdatedAt.Format(time.RFC3339Nano)
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// nextLink returns the Link header value pointing at the page after the
+// current one of the request.
+func nextLink(requestURL *url.URL, cursor string) string {
+	next := *requestURL
+	params := next.Query()
+	params.Set("cursor", cursor)
+	next.RawQuery = params.Encode()
+	return fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI())
+}
+
+func decodeTodoCursor(value string) (*todoCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor todoCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// parseDateParam accepts RFC 3339 timestamps and plain dates, which stand
+// for midnight UTC.
+func parseDateParam(value string) (time.Time, error) {
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, so user input only
+// ever matches literally.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
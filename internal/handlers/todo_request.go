@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+)
+
+var errInvalidJSON = &requestError{Status: http.StatusBadRequest, Message: "Invalid JSON body", Code: "invalid_json"}
+
+// todoRequest is the JSON body of a request creating or replacing a todo.
+// Multipart requests send the same fields as text fields, next to the
+// "files" parts.
+type todoRequest struct {
+	Title       *string `json:"title" binding:"required" example:"Buy milk"`
+	Description string  `json:"description" example:"Semi-skimmed, two bottles"`
+	Completed   bool    `json:"completed" example:"false"`
+}
+
+// cloneRequest is the optional JSON body of a request cloning a todo.
+// Fields defaults to title and description, a missing attachments list to
+// all attachments.
+type cloneRequest struct {
+	Fields      []string `json:"fields" example:"title,description"`
+	Attachments *[]uint  `json:"attachments"`
+}
+
+// readTodoRequest reads the todo sent to create or replace one: JSON when
+// the Content-Type says so, otherwise a multipart form whose files are
+// uploaded as described at readTodoForm. The fields are validated; when they are invalid nothing
+// uploaded is kept.
+func readTodoRequest(c *gin.Context, store storage.Storage, todoID uint, budget uploadBudget) (todoFields, []models.Attachment, error) {
+	if mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type")); mediaType == "application/json" {
+		fields, err := readTodoJSON(c)
+		return fields, nil, err
+	}
+	form, err := readTodoForm(c, store, todoID, budget)
+	if err != nil {
+		return todoFields{}, nil, err
+	}
+	fields, err := form.replacementFields()
+	if err != nil {
+		abandonUploads(attachmentKeys(form.Attachments))
+		return todoFields{}, nil, err
+	}
+	return fields, form.Attachments, nil
+}
+
+// readTodoJSON decodes a todoRequest. Members it doesn't know are refused
+// rather than ignored, so misspelt fields don't silently reset the todo.
+func readTodoJSON(c *gin.Context) (todoFields, error) {
+	if c.Request.ContentLength > maxJSONSize {
+		return todoFields{}, errRequestTooLarge
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, maxJSONSize))
+	decoder.DisallowUnknownFields()
+	var request todoRequest
+	if err := decoder.Decode(&request); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &typeErr):
+			return todoFields{}, invalidField(typeErr.Field, fmt.Sprintf("Field %q has the wrong type", typeErr.Field))
+		case errors.As(err, &maxBytesErr):
+			return todoFields{}, errRequestTooLarge
+		}
+		if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			name = strings.Trim(name, `"`)
+			return todoFields{}, invalidField(name, fmt.Sprintf("Unknown field %q", name))
+		}
+		return todoFields{}, errInvalidJSON
+	}
+	if request.Title == nil {
+		return todoFields{}, invalidField("title", "Title is required")
+	}
+	fields := todoFields{Title: *request.Title, Description: request.Description, Completed: request.Completed}
+	return fields, fields.validate()
+}
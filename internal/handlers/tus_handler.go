@@ -0,0 +1,701 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"todo-app/internal/cleanup"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+)
+
+// Resumable uploads follow tus 1.0 (https://tus.io/protocols/resumable-upload)
+// with the creation, termination and expiration extensions. Chunks are
+// written to a multipart upload in storage; bytes that do not fill a whole
+// part yet are kept in a tail object named after the part they will become,
+// so a failed request never corrupts what was stored before. A completed
+// upload is attached to a todo with AttachUpload.
+
+const (
+	tusVersion     = "1.0.0"
+	tusExtensions  = "creation,termination,expiration"
+	tusContentType = "application/offset+octet-stream"
+)
+
+// uploadSweepInterval is how often expired uploads are dropped.
+const uploadSweepInterval = 10 * time.Minute
+
+var errUploadIncomplete = &requestError{
+	Status:  http.StatusConflict,
+	Message: "Upload is not complete",
+	Code:    "upload_incomplete",
+}
+
+// TusOptions answers tus discovery requests.
+//
+//	@Summary	Discover the tus upload capabilities
+//	@Tags		uploads
+//	@Success	204
+//	@Header		204	{string}	Tus-Version		"Supported tus versions"
+//	@Header		204	{string}	Tus-Extension	"Supported tus extensions"
+//	@Header		204	{integer}	Tus-Max-Size	"Largest upload accepted, in bytes"
+//	@Router		/uploads [options]
+func TusOptions(c *gin.Context, db *gorm.DB) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(maxFileSize, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// CreateUpload starts a resumable upload of Upload-Length bytes. The name of
+// the file is taken from the "filename" entry of Upload-Metadata.
+//
+//	@Summary	Start a resumable upload
+//	@Tags		uploads
+//	@Produce	json
+//	@Param		Tus-Resumable	header		string	true	"tus version"	Enums(1.0.0)
+//	@Param		Upload-Length	header		int		true	"Size of the file in bytes"
+//	@Param		Upload-Metadata	header		string	false	"tus metadata, with the file name under filename"
+//	@Param		X-Owner-ID		header		string	false	"Owner of the upload"
+//	@Success	201
+//	@Header		201				{string}	Location		"URL of the upload"
+//	@Header		201				{string}	Upload-Expires	"When the upload is dropped unless completed and attached"
+//	@Failure	400				{object}	errorResponse
+//	@Failure	412				{object}	errorResponse
+//	@Failure	413				{object}	errorResponse
+//	@Failure	415				{object}	errorResponse
+//	@Router		/uploads [post]
+func CreateUpload(c *gin.Context, db *gorm.DB, store storage.Storage) {
+	if !checkTusVersion(c) {
+		return
+	}
+	if c.GetHeader("Upload-Defer-Length") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Deferred upload length is not supported"})
+		return
+	}
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Upload-Length"})
+		return
+	}
+	metadata, err := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Upload-Metadata"})
+		return
+	}
+	filename := metadata["filename"]
+	if filename == "" {
+		filename = metadata["name"]
+	}
+	owner := c.GetHeader(ownerHeader)
+	budget, err := newUploadBudget(owner, 0, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload"})
+		return
+	}
+	// The todo is not known yet; its limit is checked on attaching.
+	budget.todo = -1
+	if limit, limitErr := budget.limitFor(filename); length > limit {
+		respondError(c, limitErr, "Failed to create upload")
+		return
+	}
+
+	ctx := c.Request.Context()
+	upload := models.Upload{
+		ID:         newUploadID(),
+		Owner:      owner,
+		StorageKey: storage.NewKey("uploads", filename),
+		Filename:   filename,
+		Metadata:   c.GetHeader("Upload-Metadata"),
+		Length:     length,
+		ExpiresAt:  time.Now().Add(uploadExpiry),
+	}
+	upload.MultipartID, err = store.CreateMultipartUpload(ctx, upload.StorageKey, storage.PutOptions{
+		ContentDisposition: storage.ContentDisposition("attachment", filename),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload"})
+		return
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&upload).Error; err != nil {
+			return err
+		}
+		// The object goes when the upload expires, unless it is attached
+		// before.
+		return cleanup.Enqueue(tx, []string{upload.StorageKey}, upload.ExpiresAt)
+	})
+	if err != nil {
+		store.AbortMultipartUpload(ctx, upload.StorageKey, upload.MultipartID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload"})
+		return
+	}
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.ID)
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+// HeadUpload reports how much of an upload has arrived, so clients know
+// where to resume.
+//
+//	@Summary	Get the offset of a resumable upload
+//	@Tags		uploads
+//	@Param		uploadId		path		string	true	"Upload ID"
+//	@Param		Tus-Resumable	header		string	true	"tus version"	Enums(1.0.0)
+//	@Param		X-Owner-ID		header		string	false	"Owner of the upload"
+//	@Success	200
+//	@Header		200				{integer}	Upload-Offset	"Bytes received so far"
+//	@Header		200				{integer}	Upload-Length	"Size of the file in bytes"
+//	@Header		200				{string}	Upload-Expires	"When the upload is dropped unless completed and attached"
+//	@Failure	403
+//	@Failure	404
+//	@Failure	410
+//	@Failure	412
+//	@Router		/uploads/{uploadId} [head]
+func HeadUpload(c *gin.Context, db *gorm.DB) {
+	if !checkTusVersion(c) {
+		return
+	}
+	upload, ok := findUpload(c)
+	if !ok {
+		return
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		c.Header("Upload-Metadata", upload.Metadata)
+	}
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+}
+
+// PatchUpload appends a chunk to an upload at Upload-Offset. Whatever
+// arrives before the client drops is kept.
+//
+//	@Summary	Append a chunk to a resumable upload
+//	@Tags		uploads
+//	@Accept		application/offset+octet-stream
+//	@Produce	json
+//	@Param		uploadId		path		string	true	"Upload ID"
+//	@Param		Tus-Resumable	header		string	true	"tus version"	Enums(1.0.0)
+//	@Param		Upload-Offset	header		int		true	"Offset the chunk starts at"
+//	@Param		X-Owner-ID		header		string	false	"Owner of the upload"
+//	@Param		chunk			body		string	true	"Bytes of the file"
+//	@Success	204
+//	@Header		204				{integer}	Upload-Offset	"Bytes received so far"
+//	@Header		204				{string}	Upload-Expires	"When the upload is dropped unless completed and attached"
+//	@Failure	400				{object}	errorResponse
+//	@Failure	403				{object}	errorResponse
+//	@Failure	404				{object}	errorResponse
+//	@Failure	409				{object}	errorResponse
+//	@Failure	410				{object}	errorResponse
+//	@Failure	412				{object}	errorResponse
+//	@Failure	413				{object}	errorResponse
+//	@Failure	415				{object}	errorResponse
+//	@Failure	423				{object}	errorResponse
+//	@Router		/uploads/{uploadId} [patch]
+func PatchUpload(c *gin.Context, db *gorm.DB, store storage.Storage) {
+	if !checkTusVersion(c) {
+		return
+	}
+	if c.ContentType() != tusContentType {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be " + tusContentType})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Upload-Offset"})
+		return
+	}
+	upload, ok := findUpload(c)
+	if !ok {
+		return
+	}
+
+	// Hold the upload for the whole request so concurrent chunks cannot
+	// interleave.
+	tx := database.DB.Begin()
+	defer tx.Rollback()
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "NOWAIT"}).First(&upload, "id = ?", upload.ID).Error
+	if isLockNotAvailable(err) {
+		c.JSON(http.StatusLocked, gin.H{"error": "Upload is busy"})
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load upload"})
+		return
+	}
+	if offset != upload.Offset {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload-Offset does not match", "offset": upload.Offset})
+		return
+	}
+	if c.Request.ContentLength > upload.Length-upload.Offset {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Chunk exceeds the upload length"})
+		return
+	}
+	if !upload.Completed {
+		// Keep writing to storage when the client goes away, so what has
+		// been read is not lost.
+		stale, err := appendUpload(context.WithoutCancel(c.Request.Context()), store, &upload, c.Request.Body)
+		if err == nil {
+			err = cleanup.Expedite(tx, stale)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store upload"})
+			return
+		}
+	}
+	var rejected error
+	if upload.Completed {
+		mediaType, _, _ := mime.ParseMediaType(upload.ContentType)
+		if !contentTypeAllowed(mediaType) {
+			rejected = unsupportedTypeError(upload.Filename, mediaType)
+		}
+	}
+	if rejected != nil {
+		err = tx.Delete(&upload).Error
+		if err == nil {
+			err = cleanup.Expedite(tx, []string{upload.StorageKey})
+		}
+	} else {
+		err = tx.Save(&upload).Error
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store upload"})
+		return
+	}
+	if rejected != nil {
+		respondError(c, rejected, "Failed to store upload")
+		return
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteUpload terminates an upload and discards what was stored of it.
+//
+//	@Summary	Terminate a resumable upload
+//	@Tags		uploads
+//	@Produce	json
+//	@Param		uploadId		path	string	true	"Upload ID"
+//	@Param		Tus-Resumable	header	string	true	"tus version"	Enums(1.0.0)
+//	@Param		X-Owner-ID		header	string	false	"Owner of the upload"
+//	@Success	204
+//	@Failure	403	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Failure	410	{object}	errorResponse
+//	@Failure	412	{object}	errorResponse
+//	@Router		/uploads/{uploadId} [delete]
+func DeleteUpload(c *gin.Context, db *gorm.DB, store storage.Storage) {
+	if !checkTusVersion(c) {
+		return
+	}
+	upload, ok := findUpload(c)
+	if !ok {
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&upload).Error; err != nil {
+			return err
+		}
+		return cleanup.Expedite(tx, upload.Keys())
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete upload"})
+		return
+	}
+	if !upload.Completed {
+		if err := store.AbortMultipartUpload(c.Request.Context(), upload.StorageKey, upload.MultipartID); err != nil {
+			log.Printf("Failed to abort multipart upload of %q: %v", upload.StorageKey, err)
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// attachUploadRequest is the JSON body of AttachUpload. Filename defaults to
+// the one given when the upload was created.
+type attachUploadRequest struct {
+	UploadID string `json:"upload_id" binding:"required"`
+	Filename string `json:"filename"`
+}
+
+// AttachUpload attaches a completed resumable upload to a todo once it
+// passed the malware scan. The upload is consumed; its filename can be
+// overridden.
+//
+//	@Summary	Attach a completed resumable upload
+//	@Tags		uploads
+//	@Accept		json
+//	@Produce	json
+//	@Param		id			path		int					true	"Todo ID"
+//	@Param		X-Owner-ID	header		string				false	"Owner of the todo and the upload"
+//	@Param		upload		body		attachUploadRequest	true	"Upload to attach"
+//	@Success	201			{object}	models.Attachment
+//	@Failure	400			{object}	errorResponse
+//	@Failure	403			{object}	errorResponse
+//	@Failure	404			{object}	errorResponse
+//	@Failure	409			{object}	errorResponse
+//	@Failure	413			{object}	errorResponse
+//	@Failure	415			{object}	errorResponse
+//	@Failure	422			{object}	errorResponse
+//	@Failure	503			{object}	errorResponse
+//	@Router		/todos/{id}/attachments/uploads [post]
+func AttachUpload(c *gin.Context, db *gorm.DB, store storage.Storage) {
+	todo, ok := findOwnedTodo(c)
+	if !ok {
+		return
+	}
+	var request attachUploadRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	var existing []models.Attachment
+	if err := database.DB.Where("todo_id = ?", todo.ID).Find(&existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add attachment"})
+		return
+	}
+	budget, err := newUploadBudget(todo.Owner, attachmentsSize(existing), 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add attachment"})
+		return
+	}
+	owner := c.GetHeader(ownerHeader)
+	var upload models.Upload
+	err = database.DB.Where("id = ? AND owner = ? AND expires_at > ?", request.UploadID, owner, time.Now()).First(&upload).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return
+	}
+	if !upload.Completed {
+		respondError(c, errUploadIncomplete, "Failed to add attachment")
+		return
+	}
+	filename := request.Filename
+	if filename == "" {
+		filename = upload.Filename
+	}
+
+	// Scan before taking any locks; a completed upload no longer changes.
+	scan, err := scanUpload(c.Request.Context(), store, upload.StorageKey)
+	if err != nil {
+		respondError(c, err, "Failed to add attachment")
+		return
+	}
+	if scan.Infected {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(&upload).Error; err != nil {
+				return err
+			}
+			return quarantine(tx, []models.QuarantinedFile{{
+				StorageKey: upload.StorageKey,
+				Owner:      owner,
+				TodoID:     todo.ID,
+				Filename:   filename,
+				Size:       upload.Length,
+				Checksum:   upload.Checksum,
+				Signature:  scan.Signature,
+			}})
+		})
+		if err != nil {
+			log.Println("Failed to quarantine infected upload:", err)
+		}
+		respondError(c, malwareError(filename, scan.Signature), "Failed to add attachment")
+		return
+	}
+
+	attachments := make([]models.Attachment, 1)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND expires_at > ?", upload.ID, time.Now()).
+			First(&upload).Error
+		if err != nil {
+			return err
+		}
+		if limit, limitErr := budget.limitFor(filename); upload.Length > limit {
+			return limitErr
+		}
+		attachments[0] = models.Attachment{
+			TodoID:           todo.ID,
+			StorageKey:       upload.StorageKey,
+			OriginalFilename: filename,
+			Size:             upload.Length,
+			ContentType:      upload.ContentType,
+			Checksum:         upload.Checksum,
+			UploadedAt:       time.Now(),
+			ScanStatus:       scan.Status(),
+		}
+		if err := commitUploads(tx, attachments); err != nil {
+			return err
+		}
+		if attachments, err = saveAttachments(tx, todo.ID, attachments); err != nil {
+			return err
+		}
+		if err := touchTodo(tx, todo.ID); err != nil {
+			return err
+		}
+		return tx.Delete(&upload).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return
+	}
+	if err != nil {
+		respondError(c, err, "Failed to add attachment")
+		return
+	}
+	c.JSON(http.StatusCreated, attachments[0])
+}
+
+// ExpireUploads drops uploads past their expiry every uploadSweepInterval
+// until ctx is done. Their objects are already queued for deletion; this
+// only discards the multipart uploads and the records.
+func ExpireUploads(ctx context.Context, store storage.Storage) {
+	ticker := time.NewTicker(uploadSweepInterval)
+	defer ticker.Stop()
+	for {
+		if err := expireUploads(ctx, store); err != nil {
+			log.Println("Failed to expire uploads:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expireUploads discards the uploads past their expiry. An upload that
+// cannot be discarded is logged and tried again on the next run, without
+// holding up the others.
+func expireUploads(ctx context.Context, store storage.Storage) error {
+	var uploads []models.Upload
+	if err := database.DB.Where("expires_at <= ?", time.Now()).Find(&uploads).Error; err != nil {
+		return err
+	}
+	for _, upload := range uploads {
+		if !upload.Completed {
+			if err := store.AbortMultipartUpload(ctx, upload.StorageKey, upload.MultipartID); err != nil {
+				log.Printf("Failed to abort expired upload %s: %v", upload.ID, err)
+				continue
+			}
+		}
+		if err := database.DB.Delete(&upload).Error; err != nil {
+			log.Printf("Failed to delete expired upload %s: %v", upload.ID, err)
+		}
+	}
+	return nil
+}
+
+// lockNotAvailable is the Postgres error code for a NOWAIT lock held by
+// another transaction.
+const lockNotAvailable = "55P03"
+
+// isLockNotAvailable reports whether err is a NOWAIT lock that could not
+// be taken.
+func isLockNotAvailable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == lockNotAvailable
+}
+
+// appendUpload stores the bytes of body at the end of upload, flushing
+// every full part to the multipart upload and keeping the rest in a tail
+// object. It completes the upload once all bytes have arrived and returns
+// the keys of tail objects no longer needed. The caller must save upload.
+func appendUpload(ctx context.Context, store storage.Storage, upload *models.Upload, body io.Reader) ([]string, error) {
+	hash := sha256.New()
+	if len(upload.HashState) > 0 {
+		if err := hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(upload.HashState); err != nil {
+			return nil, err
+		}
+	}
+	buf := make([]byte, storage.MinPartSize)
+	n := 0
+	var stale []string
+	if upload.TailSize > 0 {
+		oldTail := upload.TailKey()
+		tail, err := store.GetRange(ctx, oldTail, 0, upload.TailSize)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.ReadFull(tail, buf[:upload.TailSize])
+		tail.Close()
+		if err != nil {
+			return nil, err
+		}
+		n = int(upload.TailSize)
+		stale = append(stale, oldTail)
+	}
+
+	// Only new bytes are hashed; the tail was hashed when it arrived.
+	chunk := io.TeeReader(io.LimitReader(body, upload.Length-upload.Offset), hash)
+	for {
+		read, err := io.ReadFull(chunk, buf[n:])
+		n += read
+		upload.Offset += int64(read)
+		if err != nil {
+			// The body ended, possibly because the client went away.
+			break
+		}
+		if err := uploadPart(ctx, store, upload, buf); err != nil {
+			return nil, err
+		}
+		n = 0
+	}
+
+	if upload.Offset < upload.Length {
+		if n > 0 {
+			newTail := upload.TailKey()
+			// A tail that only grew keeps its key; the saved state still
+			// reads a valid prefix of it should this request fail.
+			if len(stale) > 0 && stale[0] == newTail {
+				stale = nil
+			} else if err := cleanup.Enqueue(database.DB, []string{newTail}, upload.ExpiresAt); err != nil {
+				return nil, err
+			}
+			err := store.Put(ctx, newTail, bytes.NewReader(buf[:n]), storage.PutOptions{Size: int64(n)})
+			if err != nil {
+				return nil, err
+			}
+		}
+		upload.TailSize = int64(n)
+		state, err := hash.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		upload.HashState = state
+		return stale, nil
+	}
+
+	if n > 0 || len(upload.Parts) == 0 {
+		if err := uploadPart(ctx, store, upload, buf[:n]); err != nil {
+			return nil, err
+		}
+	}
+	parts := make([]storage.Part, len(upload.Parts))
+	for i, part := range upload.Parts {
+		parts[i] = storage.Part{Number: part.Number, ETag: part.ETag}
+	}
+	if err := store.CompleteMultipartUpload(ctx, upload.StorageKey, upload.MultipartID, parts); err != nil {
+		return nil, err
+	}
+	head, err := store.GetRange(ctx, upload.StorageKey, 0, sniffLength)
+	if err != nil {
+		return nil, err
+	}
+	sniffed, err := io.ReadAll(head)
+	head.Close()
+	if err != nil {
+		return nil, err
+	}
+	upload.ContentType = http.DetectContentType(sniffed)
+	upload.Checksum = hex.EncodeToString(hash.Sum(nil))
+	upload.TailSize = 0
+	upload.HashState = nil
+	upload.Completed = true
+	return stale, nil
+}
+
+// uploadPart stores data as the next part of upload.
+func uploadPart(ctx context.Context, store storage.Storage, upload *models.Upload, data []byte) error {
+	number := len(upload.Parts) + 1
+	part, err := store.UploadPart(ctx, upload.StorageKey, upload.MultipartID, number, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	upload.Parts = append(upload.Parts, models.UploadPart{Number: part.Number, ETag: part.ETag})
+	return nil
+}
+
+// findUpload loads the upload named by the :uploadId param. Like
+// findOwnedTodo it only hands uploads to the owner that created them. It
+// writes the error response itself and reports whether the caller should
+// carry on.
+func findUpload(c *gin.Context) (models.Upload, bool) {
+	var upload models.Upload
+	if err := database.DB.First(&upload, "id = ?", c.Param("uploadId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return upload, false
+	}
+	if upload.Owner != c.GetHeader(ownerHeader) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return upload, false
+	}
+	if !upload.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusGone, gin.H{"error": "Upload expired"})
+		return upload, false
+	}
+	return upload, true
+}
+
+// checkTusVersion rejects requests speaking another version of tus. Every
+// tus response carries the version header.
+func checkTusVersion(c *gin.Context) bool {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Unsupported tus version"})
+		return false
+	}
+	return true
+}
+
+// parseUploadMetadata decodes a tus Upload-Metadata header: comma separated
+// pairs of a key and an optional base64 encoded value.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("empty metadata key")
+		}
+		if _, ok := metadata[key]; ok {
+			return nil, fmt.Errorf("duplicate metadata key %q", key)
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// newUploadID returns a random, unguessable upload ID.
+func newUploadID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,128 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/handlers"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTusUpload(t *testing.T) {
+	// Setup Gin router and database
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Use real database for test
+	db := setupTestDB()
+	database.DB = db
+	store := storage.NewMemory()
+
+	router.POST("/uploads", func(c *gin.Context) { handlers.CreateUpload(c, db, store) })
+	router.HEAD("/uploads/:uploadId", func(c *gin.Context) { handlers.HeadUpload(c, db) })
+	router.PATCH("/uploads/:uploadId", func(c *gin.Context) { handlers.PatchUpload(c, db, store) })
+	router.DELETE("/uploads/:uploadId", func(c *gin.Context) { handlers.DeleteUpload(c, db, store) })
+	router.POST("/todos/:id/attachments/uploads", func(c *gin.Context) { handlers.AttachUpload(c, db, store) })
+
+	content := "resumable upload content"
+
+	// create starts an upload of content and returns its location
+	create := func(t *testing.T) string {
+		req, _ := http.NewRequest("POST", "/uploads", nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Upload-Length", strconv.Itoa(len(content)))
+		req.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte("notes.txt")))
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusCreated, resp.Code)
+		return resp.Header().Get("Location")
+	}
+
+	// patch sends a chunk at offset
+	patch := func(location string, offset int, chunk string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PATCH", location, bytes.NewBufferString(chunk))
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+		req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("Upload in chunks and attach", func(t *testing.T) {
+		todo := models.Todo{Title: "Test Todo"}
+		db.Create(&todo)
+		location := create(t)
+
+		resp := patch(location, 0, content[:10])
+		assert.Equal(t, http.StatusNoContent, resp.Code)
+		assert.Equal(t, "10", resp.Header().Get("Upload-Offset"))
+
+		// Resume from where the server is
+		req, _ := http.NewRequest("HEAD", location, nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "10", resp.Header().Get("Upload-Offset"))
+		assert.Equal(t, strconv.Itoa(len(content)), resp.Header().Get("Upload-Length"))
+
+		resp = patch(location, 10, content[10:])
+		assert.Equal(t, http.StatusNoContent, resp.Code)
+
+		body, _ := json.Marshal(gin.H{"upload_id": strings.TrimPrefix(location, "/uploads/")})
+		req, _ = http.NewRequest("POST", "/todos/"+strconv.Itoa(int(todo.ID))+"/attachments/uploads", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusCreated, resp.Code)
+
+		var attachment models.Attachment
+		db.Where("todo_id = ?", todo.ID).First(&attachment)
+		assert.Equal(t, "notes.txt", attachment.OriginalFilename)
+		assert.Equal(t, int64(len(content)), attachment.Size)
+		assert.Equal(t, "text/plain; charset=utf-8", attachment.ContentType)
+		info, err := store.Stat(req.Context(), attachment.StorageKey)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(content)), info.Size)
+	})
+
+	t.Run("Fail on a mismatching offset", func(t *testing.T) {
+		location := create(t)
+		resp := patch(location, 5, content)
+		assert.Equal(t, http.StatusConflict, resp.Code)
+	})
+
+	t.Run("Fail without the tus version", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/uploads", nil)
+		req.Header.Set("Upload-Length", "10")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+		assert.Equal(t, "1.0.0", resp.Header().Get("Tus-Version"))
+	})
+
+	t.Run("Terminate an upload", func(t *testing.T) {
+		location := create(t)
+		req, _ := http.NewRequest("DELETE", location, nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusNoContent, resp.Code)
+
+		resp = patch(location, 0, content)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	truncateTable(db)
+}
@@ -1,4 +1,4 @@
-package handlers
+package handlers_test
 
 import (
 	"bytes"
@@ -6,46 +6,17 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
-	"gorm.io/gorm"
-	"os"
-	"fmt"
 	"strconv"
 	"todo-app/internal/database"
 	"todo-app/internal/models"
 	"mime/multipart"
 	"todo-app/internal/handlers"
+	"todo-app/internal/storage"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
 )
 
-// Truncate the table
-func truncateTable(db *gorm.DB) {
-	db.Exec("TRUNCATE TABLE todos RESTART IDENTITY CASCADE;")
-}
-
-// Setup Test Database
-func setupTestDB() *gorm.DB {
-	godotenv.Load("../../.env")
-    dsn := fmt.Sprintf(
-        "host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-        os.Getenv("DB_HOST"),
-        os.Getenv("DB_USER"),
-        os.Getenv("DB_PASSWORD"),
-        os.Getenv("DB_NAME"),
-        os.Getenv("DB_PORT"),
-    )
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		panic("Failed to connect to test database")
-	}
-	// Auto Migrate
-	db.AutoMigrate(&models.Todo{})
-	return db
-}
-
 func TestUpdateTodo(t *testing.T) {
 	// Setup Gin router and database
 	gin.SetMode(gin.TestMode)
@@ -54,10 +25,11 @@ func TestUpdateTodo(t *testing.T) {
 	// Use real database for test
 	db := setupTestDB()
 	database.DB = db
+	store := storage.NewMemory()
 
 	// Test PUT endpoint
 	router.PUT("/todos/:id", func(c *gin.Context) {
-		handlers.UpdateTodo(c, db)
+		handlers.UpdateTodo(c, db, store)
 	})
 
 	t.Run("Update Todo successfully", func(t *testing.T) {
@@ -65,7 +37,6 @@ func TestUpdateTodo(t *testing.T) {
 		todo := models.Todo{
 			Title:       "Test Todo",
 			Description: "This is a test todo",
-			Attachment:  "",
 		}
 		db.Create(&todo)
 
@@ -80,6 +51,7 @@ func TestUpdateTodo(t *testing.T) {
 		// Send PUT request to update the todo
 		req, _ := http.NewRequest("PUT", "/todos/"+strconv.Itoa(int(todo.ID)), formData)
 		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("If-Match", "*")
 		resp := httptest.NewRecorder()
 		router.ServeHTTP(resp, req)
 
@@ -96,6 +68,80 @@ func TestUpdateTodo(t *testing.T) {
 		truncateTable(db)
 	})
 
+	t.Run("Replace every field", func(t *testing.T) {
+		todo := models.Todo{Title: "Test Todo", Description: "This is a test todo", Completed: true}
+		db.Create(&todo)
+
+		put := func(fields map[string]string) *httptest.ResponseRecorder {
+			formData := new(bytes.Buffer)
+			writer := multipart.NewWriter(formData)
+			for name, value := range fields {
+				writer.WriteField(name, value)
+			}
+			writer.Close()
+			req, _ := http.NewRequest("PUT", "/todos/"+strconv.Itoa(int(todo.ID)), formData)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			req.Header.Set("If-Match", "*")
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+			return resp
+		}
+
+		// Fields left out are reset
+		resp := put(map[string]string{"title": "Only a title"})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		var replaced models.Todo
+		db.First(&replaced, todo.ID)
+		assert.Equal(t, "Only a title", replaced.Title)
+		assert.Empty(t, replaced.Description)
+		assert.False(t, replaced.Completed)
+		assert.Nil(t, replaced.CompletedAt)
+
+		resp = put(map[string]string{"title": "Done", "completed": "true"})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		db.First(&replaced, todo.ID)
+		assert.True(t, replaced.Completed)
+		assert.NotNil(t, replaced.CompletedAt)
+
+		// The title is required
+		for _, fields := range []map[string]string{
+			{"description": "No title"},
+			{"title": "  "},
+			{"title": "Bad", "completed": "maybe"},
+		} {
+			resp = put(fields)
+			assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+			var response map[string]any
+			json.Unmarshal(resp.Body.Bytes(), &response)
+			assert.Equal(t, "invalid_field", response["code"])
+		}
+		db.First(&replaced, todo.ID)
+		assert.Equal(t, "Done", replaced.Title)
+
+		truncateTable(db)
+	})
+
+	t.Run("Replace a todo with JSON", func(t *testing.T) {
+		todo := models.Todo{Title: "Test Todo", Description: "This is a test todo"}
+		db.Create(&todo)
+
+		body := `{"title": "Replaced with JSON", "completed": true}`
+		req, _ := http.NewRequest("PUT", "/todos/"+strconv.Itoa(int(todo.ID)), bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", "*")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var replaced models.Todo
+		db.First(&replaced, todo.ID)
+		assert.Equal(t, "Replaced with JSON", replaced.Title)
+		assert.Empty(t, replaced.Description)
+		assert.True(t, replaced.Completed)
+
+		truncateTable(db)
+	})
+
 	t.Run("Fail when Todo not found", func(t *testing.T) {
 		// Send PUT request for a non-existing todo
 		req, _ := http.NewRequest("PUT", "/todos/999999", nil)
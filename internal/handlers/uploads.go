@@ -0,0 +1,431 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"todo-app/internal/cleanup"
+	"todo-app/internal/database"
+	"todo-app/internal/malware"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+)
+
+// maxFieldSize caps the plain text fields of a todo form.
+const maxFieldSize = 1 << 20
+
+// sniffLength is how much of a file http.DetectContentType looks at.
+const sniffLength = 512
+
+// ownerHeader names the request header carrying the owner of a todo. It is
+// expected to be set by the authenticating proxy in front of the API.
+const ownerHeader = "X-Owner-ID"
+
+// uploadBudget is how many more bytes a request may add to a todo and to
+// its owner's quota. Negative values mean unlimited.
+type uploadBudget struct {
+	todo  int64
+	owner int64
+}
+
+// newUploadBudget works out the budget for uploads to a todo that already
+// holds todoUsed bytes. released is the size of attachments the request will
+// replace, which no longer counts against the owner's quota.
+func newUploadBudget(owner string, todoUsed int64, released int64) (uploadBudget, error) {
+	budget := uploadBudget{todo: -1, owner: -1}
+	if maxTodoSize > 0 {
+		budget.todo = max(maxTodoSize-todoUsed, 0)
+	}
+	if ownerQuota > 0 {
+		// Prior versions of attachments count against the quota too.
+		var current, versions int64
+		err := database.DB.Model(&models.Attachment{}).
+			Joins("JOIN todos ON todos.id = attachments.todo_id").
+			Where("todos.owner = ?", owner).
+			Select("COALESCE(SUM(attachments.size), 0)").
+			Scan(&current).Error
+		if err != nil {
+			return budget, err
+		}
+		err = database.DB.Model(&models.AttachmentVersion{}).
+			Joins("JOIN attachments ON attachments.id = attachment_versions.attachment_id").
+			Joins("JOIN todos ON todos.id = attachments.todo_id").
+			Where("todos.owner = ?", owner).
+			Select("COALESCE(SUM(attachment_versions.size), 0)").
+			Scan(&versions).Error
+		if err != nil {
+			return budget, err
+		}
+		budget.owner = max(ownerQuota-current-versions+released, 0)
+	}
+	return budget, nil
+}
+
+// attachmentsSize adds up the stored size of the given attachments.
+func attachmentsSize(attachments []models.Attachment) int64 {
+	var size int64
+	for _, attachment := range attachments {
+		size += attachment.Size
+	}
+	return size
+}
+
+// contentTypeAllowed checks a sniffed media type against the configured
+// allow- and denylists.
+func contentTypeAllowed(mediaType string) bool {
+	if matchesContentType(deniedTypes, mediaType) {
+		return false
+	}
+	return len(allowedTypes) == 0 || matchesContentType(allowedTypes, mediaType)
+}
+
+// unsupportedTypeError reports a file rejected by the content type filter.
+func unsupportedTypeError(filename string, mediaType string) *requestError {
+	return &requestError{
+		Status:  http.StatusUnsupportedMediaType,
+		Message: fmt.Sprintf("File %q has a content type that is not allowed", filename),
+		Code:    "unsupported_media_type",
+		Details: gin.H{"filename": filename, "content_type": mediaType},
+	}
+}
+
+func matchesContentType(patterns []string, mediaType string) bool {
+	for _, pattern := range patterns {
+		if family, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(mediaType, family+"/") {
+				return true
+			}
+		} else if pattern == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// todoForm is a streamed create/update request: its text fields and the
+// attachments already uploaded from its file parts.
+type todoForm struct {
+	values      map[string]string
+	Attachments []models.Attachment
+}
+
+// readTodoForm streams a multipart request, uploading every "files" part
+// straight to storage under the todo's namespace instead of buffering it.
+// Files must fit the budget, pass the content type filter and the malware
+// scan. On error nothing it uploaded is left behind, except for quarantined
+// files.
+func readTodoForm(c *gin.Context, store storage.Storage, todoID uint, budget uploadBudget) (*todoForm, error) {
+	if c.Request.ContentLength > maxRequestSize {
+		return nil, errRequestTooLarge
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxRequestSize)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, errInvalidForm
+	}
+
+	form := &todoForm{values: make(map[string]string)}
+	uploads := newUploadGroup(c.Request.Context(), store, todoID, c.GetHeader(ownerHeader), budget)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			uploads.Abort()
+			return nil, readError(err)
+		}
+		switch {
+		case part.FileName() != "":
+			if part.FormName() == "files" {
+				err = uploads.Add(part)
+			}
+		default:
+			var value []byte
+			value, err = io.ReadAll(io.LimitReader(part, maxFieldSize))
+			form.values[part.FormName()] = string(value)
+		}
+		part.Close()
+		if err != nil {
+			uploads.Abort()
+			return nil, readError(err)
+		}
+	}
+
+	form.Attachments, err = uploads.Wait()
+	if err != nil {
+		return nil, err
+	}
+	for i := range form.Attachments {
+		form.Attachments[i].TodoID = todoID
+	}
+	return form, nil
+}
+
+// readError classifies an error hit while reading the request body.
+func readError(err error) error {
+	var reqErr *requestError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &reqErr):
+		return err
+	case errors.As(err, &maxBytesErr):
+		return errRequestTooLarge
+	default:
+		return errInvalidForm
+	}
+}
+
+// uploadGroup runs the uploads of one request, at most uploadConcurrency at a
+// time. Each file is piped into storage while it is read from the request,
+// so the next part can be read as soon as the previous one has been handed
+// off rather than after its upload finished.
+type uploadGroup struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	store   storage.Storage
+	todoID  uint
+	owner   string
+	budget  uploadBudget
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	results []*uploadResult
+}
+
+type uploadResult struct {
+	attachment models.Attachment
+	scan       malware.Result
+	err        error
+}
+
+func newUploadGroup(ctx context.Context, store storage.Storage, todoID uint, owner string, budget uploadBudget) *uploadGroup {
+	ctx, cancel := context.WithCancel(ctx)
+	return &uploadGroup{
+		ctx:    ctx,
+		cancel: cancel,
+		store:  store,
+		todoID: todoID,
+		owner:  owner,
+		budget: budget,
+		sem:    make(chan struct{}, uploadConcurrency),
+	}
+}
+
+// Add streams one file part to storage. It returns once the part has been
+// read completely; the upload itself and its malware scan may still be
+// running.
+func (g *uploadGroup) Add(part *multipart.Part) error {
+	filename := part.FileName()
+
+	// Sniff the real type from the content rather than trusting the
+	// client's Content-Type or the file extension.
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !contentTypeAllowed(mediaType) {
+		return unsupportedTypeError(filename, mediaType)
+	}
+
+	select {
+	case g.sem <- struct{}{}:
+	case <-g.ctx.Done():
+		return g.ctx.Err()
+	}
+
+	key := storage.NewKey(fmt.Sprintf("todos/%d", g.todoID), filename)
+	result := &uploadResult{attachment: models.Attachment{
+		StorageKey:       key,
+		OriginalFilename: filename,
+		ContentType:      contentType,
+	}}
+	g.results = append(g.results, result)
+
+	pr, pw := io.Pipe()
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer func() { <-g.sem }()
+		result.err = g.store.Put(g.ctx, key, pr, storage.PutOptions{
+			ContentType:        contentType,
+			ContentDisposition: storage.ContentDisposition("attachment", filename),
+		})
+		// Unblock the reading side if storage gave up early.
+		pr.CloseWithError(result.err)
+		// Queue the object for deletion once it is written, so the grace
+		// period does not run out while a slow upload is still going.
+		// Saving the attachment cancels this, anything else leaves it to
+		// the worker.
+		if err := cleanup.Enqueue(database.DB, []string{key}, time.Now().Add(uploadGrace)); err != nil {
+			if result.err == nil {
+				g.store.Delete(context.WithoutCancel(g.ctx), key)
+			}
+			result.err = errFileUploadFailed
+			return
+		}
+		if result.err == nil {
+			result.scan, result.err = scanUpload(g.ctx, g.store, key)
+		}
+	}()
+
+	limit, limitErr := g.budget.limitFor(filename)
+	hash := sha256.New()
+	sink := &trackedWriter{w: pw}
+	body := io.MultiReader(bytes.NewReader(head), part)
+	size, err := io.Copy(io.MultiWriter(hash, sink), io.LimitReader(body, limit+1))
+	if err == nil && size > limit {
+		err = limitErr
+	}
+	if sink.err != nil {
+		err = errFileUploadFailed
+	}
+	pw.CloseWithError(err)
+	if err != nil {
+		return err
+	}
+
+	g.budget.spend(size)
+	result.attachment.Size = size
+	result.attachment.Checksum = hex.EncodeToString(hash.Sum(nil))
+	result.attachment.UploadedAt = time.Now()
+	return nil
+}
+
+// limitFor returns how many bytes the next file may have and the error to
+// report when it has more: the per-file limit, or whatever is left of the
+// todo's or the owner's budget if that is smaller.
+func (b uploadBudget) limitFor(filename string) (int64, *requestError) {
+	limit := maxFileSize
+	err := &requestError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Message: fmt.Sprintf("File %q exceeds the maximum size of %d bytes", filename, maxFileSize),
+		Code:    "file_too_large",
+		Details: gin.H{"filename": filename, "limit": maxFileSize},
+	}
+	if b.todo >= 0 && b.todo < limit {
+		limit = b.todo
+		err = &requestError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("Attachments of a todo may not exceed %d bytes in total", maxTodoSize),
+			Code:    "todo_attachments_too_large",
+			Details: gin.H{"filename": filename, "limit": maxTodoSize},
+		}
+	}
+	if b.owner >= 0 && b.owner < limit {
+		limit = b.owner
+		err = &requestError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: "Storage quota exceeded",
+			Code:    "storage_quota_exceeded",
+			Details: gin.H{"filename": filename, "limit": ownerQuota},
+		}
+	}
+	return limit, err
+}
+
+// spend takes an accepted file off the remaining budget.
+func (b *uploadBudget) spend(size int64) {
+	if b.todo >= 0 {
+		b.todo -= size
+	}
+	if b.owner >= 0 {
+		b.owner -= size
+	}
+}
+
+// Wait blocks until every upload has been stored and scanned and returns
+// the attachments in the order their parts were received. Should any file
+// be infected, it is quarantined and the others are abandoned.
+func (g *uploadGroup) Wait() ([]models.Attachment, error) {
+	g.wg.Wait()
+	g.cancel()
+
+	var attachments []models.Attachment
+	var infected []models.QuarantinedFile
+	var failed error
+	for _, result := range g.results {
+		switch {
+		case result.err != nil:
+			if failed == nil {
+				failed = result.err
+			}
+		case result.scan.Infected:
+			infected = append(infected, models.QuarantinedFile{
+				StorageKey: result.attachment.StorageKey,
+				Owner:      g.owner,
+				TodoID:     g.todoID,
+				Filename:   result.attachment.OriginalFilename,
+				Size:       result.attachment.Size,
+				Checksum:   result.attachment.Checksum,
+				Signature:  result.scan.Signature,
+			})
+		default:
+			result.attachment.ScanStatus = result.scan.Status()
+			attachments = append(attachments, result.attachment)
+		}
+	}
+	if failed == nil && len(infected) > 0 {
+		if err := database.DB.Transaction(func(tx *gorm.DB) error { return quarantine(tx, infected) }); err != nil {
+			log.Println("Failed to quarantine infected uploads:", err)
+		}
+		failed = malwareError(infected[0].Filename, infected[0].Signature)
+	}
+	if failed != nil {
+		g.abandon()
+		var reqErr *requestError
+		if !errors.As(failed, &reqErr) {
+			failed = errFileUploadFailed
+		}
+		return nil, failed
+	}
+	return attachments, nil
+}
+
+// Abort cancels the uploads still running and abandons all of them.
+func (g *uploadGroup) Abort() {
+	g.cancel()
+	g.wg.Wait()
+	g.abandon()
+}
+
+// abandon has every object this group started writing cleaned up.
+func (g *uploadGroup) abandon() {
+	keys := make([]string, len(g.results))
+	for i, result := range g.results {
+		keys[i] = result.attachment.StorageKey
+	}
+	abandonUploads(keys)
+}
+
+// trackedWriter remembers the first write error, telling storage failures
+// apart from errors reading the request.
+type trackedWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (t *trackedWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,138 @@
+package malware
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// clamdChunkSize is how much content goes into one INSTREAM chunk. It must
+// stay below clamd's StreamMaxLength.
+const clamdChunkSize = 64 << 10
+
+// Clamd scans content with a ClamAV daemon, streaming it over the INSTREAM
+// command. A connection is opened per scan.
+type Clamd struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamd creates a scanner for the clamd listening at address, given as
+// tcp://host:port or unix:///path/to/socket. timeout bounds every scan.
+func NewClamd(address string, timeout time.Duration) (*Clamd, error) {
+	parsed, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("malware: invalid clamd address %q: %w", address, err)
+	}
+	switch parsed.Scheme {
+	case "tcp":
+		if parsed.Host == "" {
+			return nil, fmt.Errorf("malware: clamd address %q has no host", address)
+		}
+		return &Clamd{network: "tcp", address: parsed.Host, timeout: timeout}, nil
+	case "unix":
+		if parsed.Path == "" {
+			return nil, fmt.Errorf("malware: clamd address %q has no socket path", address)
+		}
+		return &Clamd{network: "unix", address: parsed.Path, timeout: timeout}, nil
+	default:
+		return nil, fmt.Errorf("malware: clamd address %q must use tcp or unix", address)
+	}
+}
+
+// Scan implements Scanner.
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return Result{}, fmt.Errorf("malware: connecting to clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Unblock reads and writes as soon as ctx is cancelled.
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	reply := bufio.NewReader(conn)
+	if err := c.stream(conn, r); err != nil {
+		// clamd hangs up early on errors such as exceeding its stream
+		// limit; its reply says more than the failed write.
+		if line, readErr := reply.ReadString(0); readErr == nil {
+			if _, parseErr := parseClamdReply(line); parseErr != nil {
+				return Result{}, parseErr
+			}
+		}
+		if ctx.Err() != nil {
+			return Result{}, ctx.Err()
+		}
+		return Result{}, err
+	}
+	line, err := reply.ReadString(0)
+	if err != nil {
+		if ctx.Err() != nil {
+			return Result{}, ctx.Err()
+		}
+		return Result{}, fmt.Errorf("malware: reading clamd reply: %w", err)
+	}
+	return parseClamdReply(line)
+}
+
+// stream sends r to clamd as length-prefixed chunks, ended by an empty one.
+func (c *Clamd) stream(conn net.Conn, r io.Reader) error {
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return fmt.Errorf("malware: sending to clamd: %w", err)
+	}
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, readErr := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return fmt.Errorf("malware: sending to clamd: %w", err)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("malware: reading content: %w", readErr)
+		}
+	}
+	binary.BigEndian.PutUint32(buf, 0)
+	if _, err := conn.Write(buf[:4]); err != nil {
+		return fmt.Errorf("malware: sending to clamd: %w", err)
+	}
+	return nil
+}
+
+// parseClamdReply interprets a reply like "stream: OK",
+// "stream: Eicar-Signature FOUND" or "INSTREAM size limit exceeded. ERROR".
+func parseClamdReply(line string) (Result, error) {
+	line = strings.TrimSpace(strings.TrimSuffix(line, "\x00"))
+	verdict := strings.TrimPrefix(line, "stream: ")
+	switch {
+	case verdict == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	case strings.HasSuffix(verdict, " ERROR"):
+		return Result{}, errors.New("malware: clamd: " + strings.TrimSuffix(verdict, " ERROR"))
+	default:
+		return Result{}, fmt.Errorf("malware: unexpected clamd reply %q", line)
+	}
+}
@@ -0,0 +1,142 @@
+package malware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"todo-app/internal/models"
+)
+
+// fakeClamd answers INSTREAM commands like clamd does, flagging streams
+// that contain the EICAR marker. It records what it received.
+func fakeClamd(t *testing.T, listener net.Listener) chan []byte {
+	t.Cleanup(func() { listener.Close() })
+	received := make(chan []byte, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			command, err := r.ReadString(0)
+			if err != nil || command != "zINSTREAM\x00" {
+				conn.Write([]byte("UNKNOWN COMMAND\x00"))
+				conn.Close()
+				continue
+			}
+			var content bytes.Buffer
+			for {
+				var size uint32
+				if err := binary.Read(r, binary.BigEndian, &size); err != nil || size == 0 {
+					break
+				}
+				io.CopyN(&content, r, int64(size))
+			}
+			received <- content.Bytes()
+			if bytes.Contains(content.Bytes(), []byte("EICAR")) {
+				conn.Write([]byte("stream: Eicar-Signature FOUND\x00"))
+			} else {
+				conn.Write([]byte("stream: OK\x00"))
+			}
+			conn.Close()
+		}
+	}()
+	return received
+}
+
+func TestClamdScan(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	received := fakeClamd(t, listener)
+	scanner, err := NewClamd("tcp://"+listener.Addr().String(), 5*time.Second)
+	require.NoError(t, err)
+
+	// Content spanning several chunks arrives intact
+	content := strings.Repeat("clean content ", 10000)
+	result, err := scanner.Scan(context.Background(), strings.NewReader(content))
+	require.NoError(t, err)
+	assert.False(t, result.Infected)
+	assert.Equal(t, models.ScanClean, result.Status())
+	assert.Equal(t, content, string(<-received))
+
+	result, err = scanner.Scan(context.Background(), strings.NewReader("X5O!P%@AP EICAR test"))
+	require.NoError(t, err)
+	assert.True(t, result.Infected)
+	assert.Equal(t, "Eicar-Signature", result.Signature)
+	assert.Equal(t, models.ScanInfected, result.Status())
+	<-received
+
+	// Empty content is scanned too
+	result, err = scanner.Scan(context.Background(), strings.NewReader(""))
+	require.NoError(t, err)
+	assert.False(t, result.Infected)
+	assert.Empty(t, <-received)
+}
+
+func TestClamdScanUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "clamd.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	received := fakeClamd(t, listener)
+	scanner, err := NewClamd("unix://"+socket, 5*time.Second)
+	require.NoError(t, err)
+
+	result, err := scanner.Scan(context.Background(), strings.NewReader("EICAR"))
+	require.NoError(t, err)
+	assert.True(t, result.Infected)
+	assert.Equal(t, "EICAR", string(<-received))
+}
+
+func TestClamdScanUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	scanner, err := NewClamd("tcp://"+address, time.Second)
+	require.NoError(t, err)
+	_, err = scanner.Scan(context.Background(), strings.NewReader("content"))
+	assert.Error(t, err)
+}
+
+func TestParseClamdReply(t *testing.T) {
+	result, err := parseClamdReply("stream: OK\x00")
+	require.NoError(t, err)
+	assert.False(t, result.Infected)
+
+	result, err = parseClamdReply("stream: Win.Test.EICAR_HDB-1 FOUND\x00")
+	require.NoError(t, err)
+	assert.Equal(t, Result{Infected: true, Signature: "Win.Test.EICAR_HDB-1"}, result)
+
+	_, err = parseClamdReply("INSTREAM size limit exceeded. ERROR\x00")
+	assert.ErrorContains(t, err, "size limit exceeded")
+
+	_, err = parseClamdReply("garbage")
+	assert.Error(t, err)
+}
+
+func TestNew(t *testing.T) {
+	scanner, err := New(Config{Scanner: "none"})
+	require.NoError(t, err)
+	assert.Equal(t, Nop{}, scanner)
+
+	scanner, err = New(Config{Scanner: "clamd", ClamdAddress: "unix:///run/clamav/clamd.ctl"})
+	require.NoError(t, err)
+	assert.Equal(t, &Clamd{network: "unix", address: "/run/clamav/clamd.ctl"}, scanner)
+
+	_, err = New(Config{Scanner: "clamd", ClamdAddress: "localhost:3310"})
+	assert.Error(t, err)
+	_, err = New(Config{Scanner: "virustotal"})
+	assert.Error(t, err)
+}
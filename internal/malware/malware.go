@@ -0,0 +1,112 @@
+package malware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+)
+
+// Scanner checks content for malware before it is attached.
+type Scanner interface {
+	// Scan reads r and reports what it found. An error means the content
+	// could not be checked, not that it is unsafe.
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// Result is the verdict of a scan.
+type Result struct {
+	Infected bool
+	// Signature names the malware found in infected content.
+	Signature string
+	// Skipped is set when the content was not looked at.
+	Skipped bool
+}
+
+// Status returns the scan status recorded for content with this result.
+func (r Result) Status() string {
+	switch {
+	case r.Infected:
+		return models.ScanInfected
+	case r.Skipped:
+		return models.ScanSkipped
+	default:
+		return models.ScanClean
+	}
+}
+
+// Nop passes everything without looking at it, for deployments that scan
+// uploads elsewhere or not at all. Its results are skipped, so the content
+// is scanned once a real scanner is configured.
+type Nop struct{}
+
+// Scan implements Scanner.
+func (Nop) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	return Result{Skipped: true}, nil
+}
+
+// ServableStatuses returns the scan statuses of content that may be served
+// or decoded while scanner is in use. Skipped content only qualifies as
+// long as no real scanner is configured.
+func ServableStatuses(scanner Scanner) []string {
+	if _, ok := scanner.(Nop); ok {
+		return []string{models.ScanClean, models.ScanSkipped}
+	}
+	return []string{models.ScanClean}
+}
+
+// Config selects and configures the scanner.
+type Config struct {
+	// Scanner is "none" or "clamd".
+	Scanner string
+	// ClamdAddress is where clamd listens, as tcp://host:port or
+	// unix:///path/to/socket.
+	ClamdAddress string
+	// Timeout bounds a single scan.
+	Timeout time.Duration
+}
+
+// ConfigFromEnv reads the scanner configuration from environment variables.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Scanner:      os.Getenv("MALWARE_SCANNER"),
+		ClamdAddress: os.Getenv("CLAMD_ADDRESS"),
+		Timeout:      2 * time.Minute,
+	}
+	if cfg.Scanner == "" {
+		cfg.Scanner = "none"
+	}
+	if cfg.ClamdAddress == "" {
+		cfg.ClamdAddress = "tcp://localhost:3310"
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("MALWARE_SCAN_TIMEOUT")); err == nil && timeout > 0 {
+		cfg.Timeout = timeout
+	}
+	return cfg
+}
+
+// New builds the scanner selected by cfg.
+func New(cfg Config) (Scanner, error) {
+	switch cfg.Scanner {
+	case "none":
+		return Nop{}, nil
+	case "clamd":
+		return NewClamd(cfg.ClamdAddress, cfg.Timeout)
+	default:
+		return nil, fmt.Errorf("malware: unknown scanner %q", cfg.Scanner)
+	}
+}
+
+// ScanObject scans the object stored under key.
+func ScanObject(ctx context.Context, store storage.Storage, scanner Scanner, key string) (Result, error) {
+	body, _, err := store.Get(ctx, key)
+	if err != nil {
+		return Result{}, err
+	}
+	defer body.Close()
+	return scanner.Scan(ctx, body)
+}
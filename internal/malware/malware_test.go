@@ -0,0 +1,24 @@
+package malware
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"todo-app/internal/models"
+)
+
+func TestNop(t *testing.T) {
+	result, err := Nop{}.Scan(context.Background(), strings.NewReader("anything"))
+	require.NoError(t, err)
+	assert.Equal(t, models.ScanSkipped, result.Status())
+
+	// Skipped content is only servable until a real scanner is configured
+	assert.Contains(t, ServableStatuses(Nop{}), models.ScanSkipped)
+	clamd, err := NewClamd("tcp://127.0.0.1:3310", time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []string{models.ScanClean}, ServableStatuses(clamd))
+}
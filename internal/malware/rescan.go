@@ -0,0 +1,119 @@
+package malware
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"gorm.io/gorm"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+)
+
+// Report is the outcome of a rescan.
+type Report struct {
+	// Scanned counts the attachments and versions whose content was
+	// scanned.
+	Scanned int
+	// Infected describes every attachment and version found infected.
+	Infected []string
+}
+
+// Print writes a human readable summary of the report to w.
+func (r *Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "Scanned %d attachments and versions\n", r.Scanned)
+	fmt.Fprintf(w, "Infected: %d\n", len(r.Infected))
+	for _, infected := range r.Infected {
+		fmt.Fprintf(w, "  %s\n", infected)
+	}
+}
+
+// SkipUnscanned records unscanned attachments and versions as skipped, for
+// servers without a scanner: they are served from then on, and scanned like
+// other skipped content once a scanner is configured. It returns how many
+// rows it changed.
+func SkipUnscanned(db *gorm.DB) (int64, error) {
+	var skipped int64
+	for _, model := range []any{&models.Attachment{}, &models.AttachmentVersion{}} {
+		result := db.Model(model).Where("scan_status = ?", models.ScanUnscanned).Update("scan_status", models.ScanSkipped)
+		if result.Error != nil {
+			return skipped, result.Error
+		}
+		skipped += result.RowsAffected
+	}
+	return skipped, nil
+}
+
+// Rescan scans the content of attachments and their prior versions and
+// records the verdicts. Only content that is unscanned, or was skipped for
+// want of a scanner, is scanned unless all is set, e.g. after the
+// signatures were updated. Content shared by several
+// attachments is scanned once. Infected content stays where it is, but is
+// no longer served.
+func Rescan(ctx context.Context, db *gorm.DB, store storage.Storage, scanner Scanner, all bool) (*Report, error) {
+	report := &Report{}
+	verdicts := make(map[string]Result)
+	scan := func(key string) (Result, error) {
+		if result, ok := verdicts[key]; ok {
+			return result, nil
+		}
+		result, err := ScanObject(ctx, store, scanner, key)
+		if err != nil {
+			return result, fmt.Errorf("scanning %q: %w", key, err)
+		}
+		verdicts[key] = result
+		return result, nil
+	}
+
+	pending := []string{models.ScanUnscanned, models.ScanSkipped}
+	var attachments []models.Attachment
+	query := db.Select("id", "todo_id", "storage_key", "original_filename").Order("id")
+	if !all {
+		query = query.Where("scan_status IN ?", pending)
+	}
+	if err := query.Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		result, err := scan(attachment.StorageKey)
+		if err != nil {
+			return report, err
+		}
+		report.Scanned++
+		if result.Infected {
+			report.Infected = append(report.Infected, fmt.Sprintf("attachment %d %q of todo %d: %s",
+				attachment.ID, attachment.OriginalFilename, attachment.TodoID, result.Signature))
+		}
+		// The content may have been replaced while it was scanned.
+		err = db.Model(&models.Attachment{}).
+			Where("id = ? AND storage_key = ?", attachment.ID, attachment.StorageKey).
+			Update("scan_status", result.Status()).Error
+		if err != nil {
+			return report, err
+		}
+	}
+
+	var versions []models.AttachmentVersion
+	query = db.Select("id", "attachment_id", "version", "storage_key").Order("id")
+	if !all {
+		query = query.Where("scan_status IN ?", pending)
+	}
+	if err := query.Find(&versions).Error; err != nil {
+		return report, err
+	}
+	for _, version := range versions {
+		result, err := scan(version.StorageKey)
+		if err != nil {
+			return report, err
+		}
+		report.Scanned++
+		if result.Infected {
+			report.Infected = append(report.Infected, fmt.Sprintf("version %d of attachment %d: %s",
+				version.Version, version.AttachmentID, result.Signature))
+		}
+		if err := db.Model(&version).Update("scan_status", result.Status()).Error; err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
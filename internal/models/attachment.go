@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Scan statuses of attachment content. Content is only served once the
+// malware scanner found it clean. Content stored while no scanner was
+// configured is skipped; it is served only as long as there is none.
+const (
+	ScanUnscanned = "unscanned"
+	ScanSkipped   = "skipped"
+	ScanClean     = "clean"
+	ScanInfected  = "infected"
+)
+
+// Attachment is a single file stored in the bucket on behalf of a todo.
+// Objects are private; clients fetch a short-lived URL by attachment ID.
+// Images get thumbnails once the thumbnail worker has processed them.
+type Attachment struct {
+	ID               uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	TodoID           uint      `json:"todo_id" gorm:"not null;index"`
+	StorageKey       string    `json:"-" gorm:"not null"`
+	OriginalFilename string    `json:"original_filename"`
+	Size             int64     `json:"size"`
+	ContentType      string    `json:"content_type"`
+	Checksum         string    `json:"checksum"`
+	UploadedAt       time.Time `json:"uploaded_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
+	// Version counts the contents the attachment has had; earlier ones are
+	// kept as AttachmentVersions.
+	Version  int                 `json:"version" gorm:"not null;default:1"`
+	Versions []AttachmentVersion `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	// ScanStatus is what the malware scanner made of the current content.
+	// Attachments stored before scanning was introduced are skipped.
+	ScanStatus string `json:"scan_status" gorm:"not null;default:'unscanned'"`
+	// ThumbnailStatus is "" until the thumbnail worker looked at an image
+	// attachment, "processing" while a worker has claimed it, then "done"
+	// or "failed".
+	ThumbnailStatus string `json:"-" gorm:"not null;default:''"`
+	// ThumbnailClaimedAt is when a worker last claimed the attachment.
+	ThumbnailClaimedAt *time.Time `json:"-"`
+	// ThumbnailAttempts counts the times the worker failed to make the
+	// thumbnails for reasons other than the image itself.
+	ThumbnailAttempts int         `json:"-" gorm:"not null;default:0"`
+	Thumbnails        []Thumbnail `json:"thumbnails,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+}
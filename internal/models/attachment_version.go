@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// AttachmentVersion is content an attachment held before a file with the
+// same name replaced it. The attachment itself always carries the current
+// version.
+type AttachmentVersion struct {
+	ID           uint      `json:"-" gorm:"primaryKey;autoIncrement"`
+	AttachmentID uint      `json:"-" gorm:"not null;uniqueIndex:idx_attachment_versions_version"`
+	Version      int       `json:"version" gorm:"not null;uniqueIndex:idx_attachment_versions_version"`
+	StorageKey   string    `json:"-" gorm:"not null"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type"`
+	Checksum     string    `json:"checksum"`
+	UploadedAt   time.Time `json:"uploaded_at"`
+	ScanStatus   string    `json:"scan_status" gorm:"not null;default:'unscanned'"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Blob is a stored object shared by every attachment with the same content.
+// RefCount tracks how many attachments point at it; the object is deleted
+// when the last of them goes.
+type Blob struct {
+	Checksum   string    `json:"checksum" gorm:"primaryKey"`
+	StorageKey string    `json:"-" gorm:"not null"`
+	Size       int64     `json:"size"`
+	RefCount   int       `json:"ref_count" gorm:"not null;default:0"`
+	CreatedAt  time.Time `json:"created_at"`
+}
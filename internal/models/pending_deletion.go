@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// PendingDeletion is an outbox entry for an object that has to be removed
+// from storage. Entries are written in the same transaction as the database
+// change that orphans the object and processed by a background worker, so
+// the bucket catches up with the database even when deletes fail.
+type PendingDeletion struct {
+	ID            uint   `gorm:"primaryKey;autoIncrement"`
+	StorageKey    string `gorm:"not null;index"`
+	Attempts      int    `gorm:"not null;default:0"`
+	LastError     string
+	NextAttemptAt time.Time `gorm:"not null;index"`
+	CreatedAt     time.Time
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// QuarantinedFile is an upload the malware scanner flagged. Its object is
+// kept for inspection but never attached, so no route serves it, and it is
+// not deleted automatically.
+type QuarantinedFile struct {
+	ID         uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	StorageKey string `json:"storage_key" gorm:"not null;uniqueIndex"`
+	// Owner is who uploaded the file, as sent in the owner header.
+	Owner     string    `json:"owner" gorm:"not null;default:'';index"`
+	TodoID    uint      `json:"todo_id"`
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	Checksum  string    `json:"checksum"`
+	Signature string    `json:"signature"`
+	CreatedAt time.Time `json:"created_at"`
+}
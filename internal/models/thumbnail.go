@@ -0,0 +1,28 @@
+package models
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Thumbnail is a scaled down copy of an image attachment, generated in the
+// background after upload. Size is the longest edge it was scaled to fit.
+type Thumbnail struct {
+	ID           uint   `json:"-" gorm:"primaryKey;autoIncrement"`
+	AttachmentID uint   `json:"-" gorm:"not null;uniqueIndex:idx_thumbnails_attachment_size"`
+	TodoID       uint   `json:"-" gorm:"not null"`
+	Size         int    `json:"size" gorm:"not null;uniqueIndex:idx_thumbnails_attachment_size"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	StorageKey   string `json:"-" gorm:"not null"`
+	ContentType  string `json:"content_type"`
+	// URL is where the API serves the thumbnail.
+	URL string `json:"url" gorm:"-"`
+}
+
+// AfterFind fills in the URL of loaded thumbnails.
+func (t *Thumbnail) AfterFind(tx *gorm.DB) error {
+	t.URL = fmt.Sprintf("/todos/%d/attachments/%d/thumbnails/%d", t.TodoID, t.AttachmentID, t.Size)
+	return nil
+}
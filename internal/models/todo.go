@@ -1,8 +1,18 @@
 package models
 
+import "time"
+
 type Todo struct {
-	ID          uint   `json:"id" gorm:"primaryKey;autoIncrement"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Attachment  string `json:"attachment,omitempty"`
-}
\ No newline at end of file
+	ID          uint         `json:"id" gorm:"primaryKey;autoIncrement"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Owner       string       `json:"owner" gorm:"not null;default:'';index"`
+	Attachments []Attachment `json:"attachments" gorm:"constraint:OnDelete:CASCADE"`
+	Completed   bool         `json:"completed" gorm:"not null;default:false;index"`
+	CompletedAt *time.Time   `json:"completed_at"`
+	CreatedAt   time.Time    `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
+	UpdatedAt   time.Time    `json:"updated_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
+	// Version counts the writes to the todo, so a write can tell whether
+	// someone else changed it first.
+	Version int `json:"version" gorm:"not null;default:1"`
+}
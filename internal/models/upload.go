@@ -0,0 +1,50 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Upload is a resumable upload sent through the tus protocol. Its content
+// goes to storage as a multipart upload; bytes that do not fill a whole
+// part yet are kept in a tail object until the next chunk arrives. Once
+// complete it can be attached to a todo, which consumes it.
+type Upload struct {
+	ID          string       `json:"id" gorm:"primaryKey"`
+	Owner       string       `json:"-" gorm:"not null;default:'';index"`
+	StorageKey  string       `json:"-" gorm:"not null"`
+	MultipartID string       `json:"-"`
+	Parts       []UploadPart `json:"-" gorm:"serializer:json"`
+	TailSize    int64        `json:"-" gorm:"not null;default:0"`
+	HashState   []byte       `json:"-"`
+	Filename    string       `json:"filename"`
+	Metadata    string       `json:"-"`
+	Length      int64        `json:"length"`
+	Offset      int64        `json:"offset" gorm:"not null;default:0"`
+	ContentType string       `json:"content_type"`
+	Checksum    string       `json:"checksum"`
+	Completed   bool         `json:"completed" gorm:"not null;default:false"`
+	ExpiresAt   time.Time    `json:"expires_at" gorm:"index"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+// UploadPart is a part of an upload already stored.
+type UploadPart struct {
+	Number int    `json:"number"`
+	ETag   string `json:"etag"`
+}
+
+// TailKey names the object holding the bytes of the upload that will make
+// up its next part.
+func (u Upload) TailKey() string {
+	return fmt.Sprintf("%s.part%d", u.StorageKey, len(u.Parts)+1)
+}
+
+// Keys returns the keys of every object the upload currently uses.
+func (u Upload) Keys() []string {
+	keys := []string{u.StorageKey}
+	if u.TailSize > 0 {
+		keys = append(keys, u.TailKey())
+	}
+	return keys
+}
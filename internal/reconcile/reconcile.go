@@ -0,0 +1,235 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+)
+
+// Options control a reconciliation run.
+type Options struct {
+	// GracePeriod protects recent objects, which may belong to an upload
+	// whose database row is not committed yet.
+	GracePeriod time.Duration
+	// DeleteOrphans removes orphans older than the grace period instead of
+	// only reporting them.
+	DeleteOrphans bool
+}
+
+// Config schedules reconciliation inside the server.
+type Config struct {
+	// Interval between runs. Zero disables the schedule.
+	Interval time.Duration
+	Options  Options
+}
+
+// Report is the outcome of a reconciliation run.
+type Report struct {
+	ScannedObjects int
+	// Orphans are objects no attachment refers to.
+	Orphans []storage.ObjectInfo
+	// Deleted lists the keys of orphans that were removed.
+	Deleted []string
+	// Missing are attachment records whose object is gone.
+	Missing []models.Attachment
+}
+
+// ConfigFromEnv reads the reconciliation schedule from environment variables.
+func ConfigFromEnv() Config {
+	cfg := Config{Options: Options{GracePeriod: 24 * time.Hour}}
+	if interval, err := time.ParseDuration(os.Getenv("RECONCILE_INTERVAL")); err == nil {
+		cfg.Interval = interval
+	}
+	if grace, err := time.ParseDuration(os.Getenv("RECONCILE_GRACE_PERIOD")); err == nil {
+		cfg.Options.GracePeriod = grace
+	}
+	if del, err := strconv.ParseBool(os.Getenv("RECONCILE_DELETE_ORPHANS")); err == nil {
+		cfg.Options.DeleteOrphans = del
+	}
+	return cfg
+}
+
+// derivedModels hold objects that belong to attachments besides their
+// current content, and quarantined uploads kept on purpose.
+var derivedModels = []any{&models.Thumbnail{}, &models.AttachmentVersion{}, &models.QuarantinedFile{}}
+
+// partSuffix matches the suffix of the tail objects of resumable uploads.
+var partSuffix = regexp.MustCompile(`\.part[0-9]+$`)
+
+// Run compares the objects in store with the attachment records in db.
+func Run(ctx context.Context, db *gorm.DB, store storage.Storage, opts Options) (*Report, error) {
+	started := time.Now()
+	var attachments []models.Attachment
+	if err := db.Select("id", "todo_id", "storage_key", "uploaded_at").Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+
+	var derived []string
+	for _, model := range derivedModels {
+		var keys []string
+		if err := db.Model(model).Pluck("storage_key", &keys).Error; err != nil {
+			return nil, err
+		}
+		derived = append(derived, keys...)
+	}
+	// Resumable uploads hold their assembled object and the tail of bytes
+	// still short of a part until they are attached or expire.
+	var uploads []models.Upload
+	if err := db.Select("id", "storage_key", "parts", "tail_size").Find(&uploads).Error; err != nil {
+		return nil, err
+	}
+	for _, upload := range uploads {
+		derived = append(derived, upload.Keys()...)
+	}
+
+	report, err := compare(ctx, store, attachments, derived, opts, started)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DeleteOrphans {
+		if err := deleteOrphans(ctx, db, store, report, started.Add(-opts.GracePeriod)); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// compare lists every object and sorts out orphans and missing objects.
+// Records created after started are skipped, as their object may not have
+// been listed. Objects derived from attachments, such as thumbnails, are
+// not orphans either.
+func compare(ctx context.Context, store storage.Storage, attachments []models.Attachment, derived []string, opts Options, started time.Time) (*Report, error) {
+	known := make(map[string]bool, len(attachments)+len(derived))
+	for _, attachment := range attachments {
+		known[attachment.StorageKey] = true
+	}
+	for _, key := range derived {
+		known[key] = true
+	}
+
+	report := &Report{}
+	seen := make(map[string]bool)
+	err := store.List(ctx, "", func(info storage.ObjectInfo) error {
+		report.ScannedObjects++
+		seen[info.Key] = true
+		if !known[info.Key] {
+			report.Orphans = append(report.Orphans, info)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range attachments {
+		if !seen[attachment.StorageKey] && attachment.UploadedAt.Before(started) {
+			report.Missing = append(report.Missing, attachment)
+		}
+	}
+	return report, nil
+}
+
+// deleteOrphans removes the orphans last modified before cutoff. Each key is
+// checked against the database once more right before it is deleted, in
+// case an attachment was saved for it since the records were loaded.
+func deleteOrphans(ctx context.Context, db *gorm.DB, store storage.Storage, report *Report, cutoff time.Time) error {
+	for _, orphan := range report.Orphans {
+		if orphan.LastModified.After(cutoff) {
+			continue
+		}
+		referenced, err := isReferenced(db, orphan.Key)
+		if err != nil {
+			return err
+		}
+		if referenced {
+			continue
+		}
+		if err := store.Delete(ctx, orphan.Key); err != nil {
+			return err
+		}
+		report.Deleted = append(report.Deleted, orphan.Key)
+	}
+	return nil
+}
+
+// isReferenced reports whether any record currently uses the object key.
+func isReferenced(db *gorm.DB, key string) (bool, error) {
+	for _, model := range append([]any{&models.Attachment{}}, derivedModels...) {
+		var count int64
+		if err := db.Model(model).Where("storage_key = ?", key).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	// A tail object is named after its upload's key.
+	var uploads []models.Upload
+	base := partSuffix.ReplaceAllString(key, "")
+	if err := db.Select("id", "storage_key", "parts", "tail_size").Where("storage_key IN ?", []string{key, base}).Find(&uploads).Error; err != nil {
+		return false, err
+	}
+	for _, upload := range uploads {
+		for _, uploadKey := range upload.Keys() {
+			if uploadKey == key {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Print writes a human readable version of the report.
+func (r *Report) Print(w io.Writer) {
+	for _, orphan := range r.Orphans {
+		fmt.Fprintf(w, "orphan: %s (%d bytes, last modified %s)\n", orphan.Key, orphan.Size, orphan.LastModified.Format(time.RFC3339))
+	}
+	for _, key := range r.Deleted {
+		fmt.Fprintf(w, "deleted: %s\n", key)
+	}
+	for _, attachment := range r.Missing {
+		fmt.Fprintf(w, "missing: attachment %d of todo %d (%s)\n", attachment.ID, attachment.TodoID, attachment.StorageKey)
+	}
+	fmt.Fprintf(w, "%s\n", r.Summary())
+}
+
+// Summary condenses the report into one line.
+func (r *Report) Summary() string {
+	return fmt.Sprintf("scanned %d objects: %d orphaned, %d deleted, %d attachments missing their object",
+		r.ScannedObjects, len(r.Orphans), len(r.Deleted), len(r.Missing))
+}
+
+// Schedule runs reconciliation every cfg.Interval until ctx is done, logging
+// each report. It returns immediately when no interval is configured.
+func Schedule(ctx context.Context, db *gorm.DB, store storage.Storage, cfg Config) {
+	if cfg.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := Run(ctx, db, store, cfg.Options)
+			if err != nil {
+				log.Println("Reconciliation failed:", err)
+				continue
+			}
+			log.Println("Reconciliation:", report.Summary())
+			for _, attachment := range report.Missing {
+				log.Printf("Reconciliation: attachment %d of todo %d is missing object %q", attachment.ID, attachment.TodoID, attachment.StorageKey)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package reconcile
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+)
+
+func TestCompare(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	store.Put(ctx, "todos/1/a/kept.txt", strings.NewReader("kept"), storage.PutOptions{})
+	store.Put(ctx, "todos/1/b/orphan.txt", strings.NewReader("orphan"), storage.PutOptions{})
+	store.Put(ctx, "todos/1/thumbnails/1/128.jpg", strings.NewReader("thumbnail"), storage.PutOptions{})
+
+	started := time.Now()
+	attachments := []models.Attachment{
+		{ID: 1, TodoID: 1, StorageKey: "todos/1/a/kept.txt", UploadedAt: started.Add(-time.Hour)},
+		{ID: 2, TodoID: 1, StorageKey: "todos/1/c/gone.txt", UploadedAt: started.Add(-time.Hour)},
+		// Saved while the run was listing, so its object may not have been seen.
+		{ID: 3, TodoID: 2, StorageKey: "todos/2/d/new.txt", UploadedAt: started.Add(time.Second)},
+	}
+
+	report, err := compare(ctx, store, attachments, []string{"todos/1/thumbnails/1/128.jpg"}, Options{}, started)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, report.ScannedObjects)
+	require.Len(t, report.Orphans, 1)
+	assert.Equal(t, "todos/1/b/orphan.txt", report.Orphans[0].Key)
+	require.Len(t, report.Missing, 1)
+	assert.Equal(t, uint(2), report.Missing[0].ID)
+	assert.Contains(t, report.Summary(), "1 orphaned")
+}
+
+func TestCompareKeepsPendingUploads(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	pending := models.Upload{
+		ID:         "pending",
+		StorageKey: "uploads/a/video.mp4",
+		Parts:      []models.UploadPart{{Number: 1, ETag: `"1"`}},
+		TailSize:   4,
+	}
+	completed := models.Upload{ID: "completed", StorageKey: "uploads/b/report.pdf", Completed: true}
+	store.Put(ctx, pending.TailKey(), strings.NewReader("tail"), storage.PutOptions{})
+	store.Put(ctx, completed.StorageKey, strings.NewReader("report"), storage.PutOptions{})
+	// The tail of an earlier part is no longer used by the upload.
+	store.Put(ctx, "uploads/a/video.mp4.part1", strings.NewReader("stale"), storage.PutOptions{})
+
+	var derived []string
+	for _, upload := range []models.Upload{pending, completed} {
+		derived = append(derived, upload.Keys()...)
+	}
+	report, err := compare(ctx, store, nil, derived, Options{}, time.Now())
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, report.ScannedObjects)
+	require.Len(t, report.Orphans, 1)
+	assert.Equal(t, "uploads/a/video.mp4.part1", report.Orphans[0].Key)
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("RECONCILE_INTERVAL", "6h")
+	t.Setenv("RECONCILE_GRACE_PERIOD", "2h")
+	t.Setenv("RECONCILE_DELETE_ORPHANS", "true")
+
+	cfg := ConfigFromEnv()
+	assert.Equal(t, 6*time.Hour, cfg.Interval)
+	assert.Equal(t, 2*time.Hour, cfg.Options.GracePeriod)
+	assert.True(t, cfg.Options.DeleteOrphans)
+}
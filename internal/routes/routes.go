@@ -4,12 +4,37 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"todo-app/internal/handlers"
+	"todo-app/internal/storage"
 )
 
-func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
+func RegisterRoutes(r *gin.Engine, db *gorm.DB, store storage.Storage) {
 	r.GET("/todos", func(c *gin.Context) { handlers.GetTodos(c, db) })
+	r.GET("/todos/search", func(c *gin.Context) { handlers.SearchTodos(c, db) })
 	r.GET("/todos/:id", func(c *gin.Context) { handlers.GetTodoByID(c, db) })
-	r.POST("/todos", func(c *gin.Context) { handlers.CreateTodo(c, db) })
-	r.PUT("/todos/:id", func(c *gin.Context) { handlers.UpdateTodo(c, db) })
-	r.DELETE("/todos/:id", func(c *gin.Context) { handlers.DeleteTodo(c, db) })
+	r.POST("/todos", func(c *gin.Context) { handlers.CreateTodo(c, db, store) })
+	r.PUT("/todos/:id", func(c *gin.Context) { handlers.UpdateTodo(c, db, store) })
+	r.PATCH("/todos/:id", func(c *gin.Context) { handlers.PatchTodo(c, db) })
+	r.DELETE("/todos/:id", func(c *gin.Context) { handlers.DeleteTodo(c, db, store) })
+	r.POST("/todos/:id/complete", func(c *gin.Context) { handlers.CompleteTodo(c, db) })
+	r.POST("/todos/:id/reopen", func(c *gin.Context) { handlers.ReopenTodo(c, db) })
+	r.POST("/todos/:id/clone", func(c *gin.Context) { handlers.CloneTodo(c, db, store) })
+	r.GET("/todos/:id/attachments", func(c *gin.Context) { handlers.GetAttachments(c, db) })
+	r.GET("/todos/:id/attachments.zip", func(c *gin.Context) { handlers.GetAttachmentsArchive(c, db, store) })
+	r.POST("/todos/:id/attachments", func(c *gin.Context) { handlers.AddAttachments(c, db, store) })
+	r.POST("/todos/:id/attachments/by-checksum", func(c *gin.Context) { handlers.AttachByChecksum(c, db) })
+	r.POST("/todos/:id/attachments/uploads", func(c *gin.Context) { handlers.AttachUpload(c, db, store) })
+	r.DELETE("/todos/:id/attachments/:attachmentId", func(c *gin.Context) { handlers.DeleteAttachment(c, db, store) })
+	r.GET("/todos/:id/attachments/:attachmentId/url", func(c *gin.Context) { handlers.GetAttachmentURL(c, db, store) })
+	r.GET("/todos/:id/attachments/:attachmentId/content", func(c *gin.Context) { handlers.GetAttachmentContent(c, db, store) })
+	r.HEAD("/todos/:id/attachments/:attachmentId/content", func(c *gin.Context) { handlers.GetAttachmentContent(c, db, store) })
+	r.GET("/todos/:id/attachments/:attachmentId/thumbnails/:size", func(c *gin.Context) { handlers.GetAttachmentThumbnail(c, db, store) })
+	r.GET("/todos/:id/attachments/:attachmentId/versions", func(c *gin.Context) { handlers.GetAttachmentVersions(c, db) })
+	r.GET("/todos/:id/attachments/:attachmentId/versions/:version/content", func(c *gin.Context) { handlers.GetAttachmentVersionContent(c, db, store) })
+	r.POST("/todos/:id/attachments/:attachmentId/versions/:version/restore", func(c *gin.Context) { handlers.RestoreAttachmentVersion(c, db) })
+	r.POST("/attachments/check", func(c *gin.Context) { handlers.CheckChecksums(c, db) })
+	r.OPTIONS("/uploads", func(c *gin.Context) { handlers.TusOptions(c, db) })
+	r.POST("/uploads", func(c *gin.Context) { handlers.CreateUpload(c, db, store) })
+	r.HEAD("/uploads/:uploadId", func(c *gin.Context) { handlers.HeadUpload(c, db) })
+	r.PATCH("/uploads/:uploadId", func(c *gin.Context) { handlers.PatchUpload(c, db, store) })
+	r.DELETE("/uploads/:uploadId", func(c *gin.Context) { handlers.DeleteUpload(c, db, store) })
 }
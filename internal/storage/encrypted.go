@@ -0,0 +1,700 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Objects written through EncryptedStorage are encrypted with envelope
+// encryption. Every object gets a random data key, which encrypts its
+// content with AES-256-GCM and is kept in the object's header wrapped by a
+// master key. Rotating the master key therefore only re-wraps data keys;
+// the content is never re-encrypted.
+//
+// An encrypted object is the header followed by the content in segments
+// of encSegmentSize bytes, each sealed on its own with a nonce made of the
+// header's nonce prefix and the segment's index. Segments can be decrypted
+// individually, which keeps ranged reads cheap, but not reordered. The last
+// segment, empty for empty content, is sealed with encFinalAAD, so an
+// object cut short at a segment boundary fails to decrypt like any other
+// damaged one.
+//
+//	magic (8) | master key ID (8) | wrap nonce (12) | wrapped data key (48) | nonce prefix (8)
+
+const (
+	encMagic       = "\x89TDENC\r\n"
+	encKeyIDSize   = 8
+	encPrefixSize  = 8
+	encSegmentSize = 64 << 10
+	encTagSize     = 16
+	encWrappedSize = 12 + 32 + encTagSize
+	encHeaderSize  = len(encMagic) + encKeyIDSize + encWrappedSize + encPrefixSize
+)
+
+// encFinalAAD is the additional data authenticated with the last segment.
+var encFinalAAD = []byte("final")
+
+// encFinalPart marks the ETag of a multipart upload part that holds the
+// last segment, which lets CompleteMultipartUpload tell whether the object
+// still needs one.
+const encFinalPart = "+final"
+
+// ErrPresignUnsupported is returned by stores that cannot hand out expiring
+// direct URLs, such as local storage, or must not, such as EncryptedStorage,
+// whose objects must be decrypted first.
+var ErrPresignUnsupported = errors.New("storage: presigned URLs are not supported")
+
+// ErrCorrupt is returned when an encrypted object fails authentication,
+// because it was damaged or tampered with.
+var ErrCorrupt = errors.New("storage: encrypted object is corrupt")
+
+// Keyring holds the master keys data keys are wrapped with. New data keys
+// are wrapped with the current key; the others are kept to unwrap what was
+// stored before a rotation.
+type Keyring struct {
+	current [encKeyIDSize]byte
+	keys    map[[encKeyIDSize]byte]cipher.AEAD
+}
+
+// NewKeyring builds a keyring from 32 byte AES-256 master keys. The first
+// key is the current one.
+func NewKeyring(keys [][]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("storage: no encryption keys")
+	}
+	ring := &Keyring{keys: make(map[[encKeyIDSize]byte]cipher.AEAD)}
+	for i, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("storage: encryption key %d is %d bytes, want 32", i+1, len(key))
+		}
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		id := masterKeyID(key)
+		if i == 0 {
+			ring.current = id
+		}
+		ring.keys[id] = aead
+	}
+	return ring, nil
+}
+
+// LoadKeyring reads master keys from a comma or newline separated list of
+// base64 encoded keys, or from the file at path when keys is empty. Lines
+// starting with # are ignored.
+func LoadKeyring(keys string, path string) (*Keyring, error) {
+	if keys == "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("storage: reading encryption keys: %w", err)
+		}
+		keys = string(data)
+	}
+	var decoded [][]byte
+	for _, line := range strings.FieldsFunc(keys, func(r rune) bool { return r == ',' || r == '\n' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("storage: encryption key %d is not valid base64: %w", len(decoded)+1, err)
+		}
+		decoded = append(decoded, key)
+	}
+	return NewKeyring(decoded)
+}
+
+// masterKeyID identifies a master key in object headers without giving
+// anything away about it.
+func masterKeyID(key []byte) [encKeyIDSize]byte {
+	sum := sha256.Sum256(append([]byte("todo-app master key id\x00"), key...))
+	var id [encKeyIDSize]byte
+	copy(id[:], sum[:])
+	return id
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encHeader is the parsed header of an encrypted object.
+type encHeader struct {
+	keyID   [encKeyIDSize]byte
+	wrapped []byte
+	prefix  []byte
+}
+
+// newHeader creates a random data key wrapped with the current master key
+// and returns the header for it along with the key's cipher.
+func (k *Keyring) newHeader() (encHeader, cipher.AEAD, error) {
+	dataKey := make([]byte, 32)
+	prefix := make([]byte, encPrefixSize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return encHeader{}, nil, err
+	}
+	if _, err := rand.Read(prefix); err != nil {
+		return encHeader{}, nil, err
+	}
+	header := encHeader{prefix: prefix}
+	if err := k.wrap(&header, dataKey); err != nil {
+		return encHeader{}, nil, err
+	}
+	aead, err := newGCM(dataKey)
+	return header, aead, err
+}
+
+// wrap seals dataKey into header with the current master key.
+func (k *Keyring) wrap(header *encHeader, dataKey []byte) error {
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	header.keyID = k.current
+	header.wrapped = k.keys[k.current].Seal(nonce, nonce, dataKey, header.keyID[:])
+	return nil
+}
+
+// unwrap recovers the data key of header.
+func (k *Keyring) unwrap(header encHeader) ([]byte, error) {
+	master, ok := k.keys[header.keyID]
+	if !ok {
+		return nil, fmt.Errorf("storage: object was encrypted with unknown master key %x", header.keyID)
+	}
+	dataKey, err := master.Open(nil, header.wrapped[:12], header.wrapped[12:], header.keyID[:])
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return dataKey, nil
+}
+
+// open returns the cipher for the content behind header.
+func (k *Keyring) open(header encHeader) (cipher.AEAD, error) {
+	dataKey, err := k.unwrap(header)
+	if err != nil {
+		return nil, err
+	}
+	return newGCM(dataKey)
+}
+
+func (h encHeader) marshal() []byte {
+	buf := make([]byte, 0, encHeaderSize)
+	buf = append(buf, encMagic...)
+	buf = append(buf, h.keyID[:]...)
+	buf = append(buf, h.wrapped...)
+	return append(buf, h.prefix...)
+}
+
+// parseHeader reads a header from data, reporting false when data does not
+// start with one, as for objects stored before encryption was enabled.
+func parseHeader(data []byte) (encHeader, bool) {
+	if len(data) < encHeaderSize || string(data[:len(encMagic)]) != encMagic {
+		return encHeader{}, false
+	}
+	data = data[len(encMagic):]
+	var header encHeader
+	copy(header.keyID[:], data)
+	data = data[encKeyIDSize:]
+	header.wrapped = bytes.Clone(data[:encWrappedSize])
+	header.prefix = bytes.Clone(data[encWrappedSize : encWrappedSize+encPrefixSize])
+	return header, true
+}
+
+// encryptedSize is the stored size of size bytes of content, without the
+// header.
+func encryptedSize(size int64) int64 {
+	segments := max((size+encSegmentSize-1)/encSegmentSize, 1)
+	return size + segments*encTagSize
+}
+
+// plaintextSize is the content size of an encrypted object of size bytes.
+func plaintextSize(size int64) int64 {
+	body := size - int64(encHeaderSize)
+	segments := (body + encSegmentSize + encTagSize - 1) / (encSegmentSize + encTagSize)
+	return body - segments*encTagSize
+}
+
+func segmentNonce(prefix []byte, index uint32) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[encPrefixSize:], index)
+	return nonce
+}
+
+// EncryptedStorage encrypts objects on their way into another Storage and
+// decrypts them on their way out. Objects stored in plaintext before
+// encryption was enabled are still read as they are. Listed sizes are the
+// stored ones; Get and Stat report the size of the content.
+type EncryptedStorage struct {
+	inner Storage
+	keys  *Keyring
+}
+
+// NewEncrypted wraps inner so everything it stores is encrypted with data
+// keys wrapped by keys.
+func NewEncrypted(inner Storage, keys *Keyring) *EncryptedStorage {
+	return &EncryptedStorage{inner: inner, keys: keys}
+}
+
+func (e *EncryptedStorage) Put(ctx context.Context, key string, body io.Reader, opts PutOptions) error {
+	header, aead, err := e.keys.newHeader()
+	if err != nil {
+		return err
+	}
+	if opts.Size > 0 {
+		opts.Size = int64(encHeaderSize) + encryptedSize(opts.Size)
+	}
+	return e.inner.Put(ctx, key, newEncryptReader(body, aead, header, 0, true, true), opts)
+}
+
+func (e *EncryptedStorage) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	body, info, err := e.inner.Get(ctx, key)
+	if err != nil {
+		return nil, info, err
+	}
+	buffered := bufio.NewReaderSize(body, encSegmentSize)
+	head, _ := buffered.Peek(encHeaderSize)
+	header, ok := parseHeader(head)
+	if !ok {
+		return readCloser{buffered, body}, info, nil
+	}
+	aead, err := e.keys.open(header)
+	if err != nil {
+		body.Close()
+		return nil, info, err
+	}
+	buffered.Discard(encHeaderSize)
+	info.Size = plaintextSize(info.Size)
+	return readCloser{newDecryptReader(buffered, aead, header.prefix, 0, 0, -1), body}, info, nil
+}
+
+func (e *EncryptedStorage) GetRange(ctx context.Context, key string, offset int64, length int64) (io.ReadCloser, error) {
+	header, ok, err := e.readHeader(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return e.inner.GetRange(ctx, key, offset, length)
+	}
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	aead, err := e.keys.open(header)
+	if err != nil {
+		return nil, err
+	}
+	first := offset / encSegmentSize
+	storedOffset := int64(encHeaderSize) + first*(encSegmentSize+encTagSize)
+	storedLength := int64(-1)
+	if length > 0 {
+		last := (offset + length + encSegmentSize - 1) / encSegmentSize
+		storedLength = (last - first) * (encSegmentSize + encTagSize)
+	}
+	body, err := e.inner.GetRange(ctx, key, storedOffset, storedLength)
+	if err != nil {
+		return nil, err
+	}
+	skip := int(offset - first*encSegmentSize)
+	return readCloser{newDecryptReader(body, aead, header.prefix, uint32(first), skip, length), body}, nil
+}
+
+// Copy copies the object as stored. Headers don't depend on the key, so
+// the copy decrypts with the same data key.
+func (e *EncryptedStorage) Copy(ctx context.Context, src string, dst string) error {
+	return e.inner.Copy(ctx, src, dst)
+}
+
+func (e *EncryptedStorage) Delete(ctx context.Context, key string) error {
+	return e.inner.Delete(ctx, key)
+}
+
+func (e *EncryptedStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := e.inner.Stat(ctx, key)
+	if err != nil || info.Size < int64(encHeaderSize) {
+		return info, err
+	}
+	_, ok, err := e.readHeader(ctx, key)
+	if err != nil {
+		return info, err
+	}
+	if ok {
+		info.Size = plaintextSize(info.Size)
+	}
+	return info, nil
+}
+
+func (e *EncryptedStorage) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	return e.inner.List(ctx, prefix, fn)
+}
+
+func (e *EncryptedStorage) URL(key string) string {
+	return e.inner.URL(key)
+}
+
+// PresignGet always fails with ErrPresignUnsupported: a direct URL would
+// hand out the encrypted object.
+func (e *EncryptedStorage) PresignGet(ctx context.Context, key string, ttl time.Duration, contentDisposition string) (string, error) {
+	return "", ErrPresignUnsupported
+}
+
+// CreateMultipartUpload starts an encrypted multipart upload. Its data key
+// travels inside the returned upload ID, wrapped like in a header, so parts
+// can be encrypted by whichever request delivers them. Every part but the
+// last must be exactly MinPartSize bytes, which lets parts be encrypted
+// independently of each other. A shorter part is taken to be the last one
+// and ends in the object's last segment.
+func (e *EncryptedStorage) CreateMultipartUpload(ctx context.Context, key string, opts PutOptions) (string, error) {
+	header, _, err := e.keys.newHeader()
+	if err != nil {
+		return "", err
+	}
+	uploadID, err := e.inner.CreateMultipartUpload(ctx, key, opts)
+	if err != nil {
+		return "", err
+	}
+	return uploadID + "." + base64.RawURLEncoding.EncodeToString(header.marshal()), nil
+}
+
+func (e *EncryptedStorage) UploadPart(ctx context.Context, key string, uploadID string, number int, body io.Reader, size int64) (Part, error) {
+	innerID, header, err := splitUploadID(uploadID)
+	if err != nil {
+		return Part{}, err
+	}
+	if size > MinPartSize {
+		return Part{}, fmt.Errorf("storage: encrypted parts may not exceed %d bytes", MinPartSize)
+	}
+	return e.uploadPart(ctx, key, innerID, header, number, body, size, size < MinPartSize)
+}
+
+// CompleteMultipartUpload assembles the upload, adding a part that holds
+// just the last segment when the last part was a full one.
+func (e *EncryptedStorage) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []Part) error {
+	innerID, header, err := splitUploadID(uploadID)
+	if err != nil {
+		return err
+	}
+	inner := make([]Part, len(parts))
+	final := false
+	for i, part := range parts {
+		inner[i] = part
+		inner[i].ETag, final = strings.CutSuffix(part.ETag, encFinalPart)
+	}
+	if !final {
+		last, err := e.uploadPart(ctx, key, innerID, header, len(parts)+1, strings.NewReader(""), 0, true)
+		if err != nil {
+			return err
+		}
+		inner = append(inner, Part{Number: last.Number, ETag: strings.TrimSuffix(last.ETag, encFinalPart)})
+	}
+	return e.inner.CompleteMultipartUpload(ctx, key, innerID, inner)
+}
+
+// uploadPart encrypts body as part number of an upload to the inner store.
+// Parts are MinPartSize bytes apart, so the index of their first segment
+// follows from the number. final marks the part that ends the object.
+func (e *EncryptedStorage) uploadPart(ctx context.Context, key string, innerID string, header encHeader, number int, body io.Reader, size int64, final bool) (Part, error) {
+	aead, err := e.keys.open(header)
+	if err != nil {
+		return Part{}, err
+	}
+	storedSize := size + size/encSegmentSize*encTagSize
+	if final {
+		storedSize = encryptedSize(size)
+	}
+	if number == 1 {
+		storedSize += int64(encHeaderSize)
+	}
+	first := uint32((number - 1) * (MinPartSize / encSegmentSize))
+	part, err := e.inner.UploadPart(ctx, key, innerID, number, newEncryptReader(body, aead, header, first, number == 1, final), storedSize)
+	if err != nil {
+		return Part{}, err
+	}
+	if final {
+		part.ETag += encFinalPart
+	}
+	return part, nil
+}
+
+func (e *EncryptedStorage) AbortMultipartUpload(ctx context.Context, key string, uploadID string) error {
+	innerID, _, err := splitUploadID(uploadID)
+	if err != nil {
+		return err
+	}
+	return e.inner.AbortMultipartUpload(ctx, key, innerID)
+}
+
+// RotateKeys re-wraps the data key of every object that is not wrapped
+// with the current master key yet. Object stores cannot change part of an
+// object in place, so each such object is stored again: the new header
+// followed by the content as it was, still encrypted, with the content
+// type and disposition the object had. It returns how many objects were
+// rewritten. Multipart uploads started before the rotation still use the
+// key they were started with, so keep the previous keys until those have
+// completed or expired, then rotate again.
+func (e *EncryptedStorage) RotateKeys(ctx context.Context) (int, error) {
+	var objects []ObjectInfo
+	err := e.inner.List(ctx, "", func(info ObjectInfo) error {
+		if info.Size >= int64(encHeaderSize) {
+			objects = append(objects, info)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	for _, info := range objects {
+		header, ok, err := e.readHeader(ctx, info.Key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return rotated, err
+		}
+		if !ok || header.keyID == e.keys.current {
+			continue
+		}
+		// Listings may leave out the metadata to carry over.
+		stat, err := e.inner.Stat(ctx, info.Key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return rotated, err
+		}
+		dataKey, err := e.keys.unwrap(header)
+		if err != nil {
+			return rotated, fmt.Errorf("storage: unwrapping %q: %w", info.Key, err)
+		}
+		if err := e.keys.wrap(&header, dataKey); err != nil {
+			return rotated, err
+		}
+		var rest io.ReadCloser = io.NopCloser(strings.NewReader(""))
+		if stat.Size > int64(encHeaderSize) {
+			if rest, err = e.inner.GetRange(ctx, info.Key, int64(encHeaderSize), -1); err != nil {
+				return rotated, err
+			}
+		}
+		// The content stays as it is; only the header is new.
+		err = e.inner.Put(ctx, info.Key, io.MultiReader(bytes.NewReader(header.marshal()), rest), PutOptions{
+			ContentType:        stat.ContentType,
+			ContentDisposition: stat.ContentDisposition,
+			Size:               stat.Size,
+		})
+		rest.Close()
+		if err != nil {
+			return rotated, fmt.Errorf("storage: rewriting %q: %w", info.Key, err)
+		}
+		rotated++
+	}
+	return rotated, nil
+}
+
+// readHeader loads the header of the object stored under key, reporting
+// false for plaintext objects.
+func (e *EncryptedStorage) readHeader(ctx context.Context, key string) (encHeader, bool, error) {
+	body, err := e.inner.GetRange(ctx, key, 0, int64(encHeaderSize))
+	if err != nil {
+		return encHeader{}, false, err
+	}
+	defer body.Close()
+	head, err := io.ReadAll(body)
+	if err != nil {
+		return encHeader{}, false, err
+	}
+	header, ok := parseHeader(head)
+	return header, ok, nil
+}
+
+// splitUploadID takes an upload ID from CreateMultipartUpload apart into
+// the inner store's ID and the header carrying the data key.
+func splitUploadID(uploadID string) (string, encHeader, error) {
+	i := strings.LastIndexByte(uploadID, '.')
+	if i < 0 {
+		return "", encHeader{}, ErrNotFound
+	}
+	data, err := base64.RawURLEncoding.DecodeString(uploadID[i+1:])
+	if err != nil {
+		return "", encHeader{}, ErrNotFound
+	}
+	header, ok := parseHeader(data)
+	if !ok {
+		return "", encHeader{}, ErrNotFound
+	}
+	return uploadID[:i], header, nil
+}
+
+// encryptReader encrypts what it reads from src segment by segment,
+// optionally preceded by the header. When final is set, the last segment
+// is sealed as the last one of the object; src is read one byte ahead to
+// know which segment that is.
+type encryptReader struct {
+	src      io.Reader
+	aead     cipher.AEAD
+	nonce    []byte
+	index    uint32
+	final    bool
+	plain    []byte
+	buffered int
+	out      []byte
+	pos      int
+	done     bool
+}
+
+func newEncryptReader(src io.Reader, aead cipher.AEAD, header encHeader, first uint32, withHeader bool, final bool) *encryptReader {
+	r := &encryptReader{
+		src:   src,
+		aead:  aead,
+		nonce: header.prefix,
+		index: first,
+		final: final,
+		plain: make([]byte, encSegmentSize+1),
+	}
+	if withHeader {
+		r.out = header.marshal()
+	}
+	return r
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for r.pos == len(r.out) {
+		if r.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(r.src, r.plain[r.buffered:])
+		r.buffered += n
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			r.done = true
+		} else if err != nil {
+			return 0, err
+		}
+		r.out = r.out[:0]
+		r.pos = 0
+		segment := r.plain[:min(r.buffered, encSegmentSize)]
+		var aad []byte
+		if r.done && r.final {
+			aad = encFinalAAD
+		}
+		if len(segment) > 0 || aad != nil {
+			r.out = r.aead.Seal(r.out, segmentNonce(r.nonce, r.index), segment, aad)
+			r.index++
+		}
+		if !r.done {
+			// Keep the byte read ahead for the next segment.
+			r.plain[0] = r.plain[encSegmentSize]
+			r.buffered = 1
+		}
+	}
+	n := copy(p, r.out[r.pos:])
+	r.pos += n
+	return n, nil
+}
+
+// decryptReader decrypts segments read from src, starting at segment first.
+// It drops skip bytes of content and stops after limit bytes unless limit
+// is negative. Running out of segments before the last one of the object
+// is reported as ErrCorrupt.
+type decryptReader struct {
+	src    io.Reader
+	aead   cipher.AEAD
+	nonce  []byte
+	index  uint32
+	skip   int
+	limit  int64
+	sealed []byte
+	out    []byte
+	pos    int
+	done   bool
+	final  bool
+}
+
+func newDecryptReader(src io.Reader, aead cipher.AEAD, prefix []byte, first uint32, skip int, limit int64) *decryptReader {
+	return &decryptReader{
+		src:    src,
+		aead:   aead,
+		nonce:  prefix,
+		index:  first,
+		skip:   skip,
+		limit:  limit,
+		sealed: make([]byte, encSegmentSize+encTagSize),
+	}
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	if r.limit == 0 {
+		return 0, io.EOF
+	}
+	for r.pos == len(r.out) {
+		if r.done {
+			if !r.final {
+				return 0, ErrCorrupt
+			}
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(r.src, r.sealed)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			r.done = true
+		} else if err != nil {
+			return 0, err
+		}
+		r.out = r.out[:0]
+		r.pos = 0
+		if n == 0 {
+			continue
+		}
+		if r.final {
+			// Nothing may follow the last segment.
+			return 0, ErrCorrupt
+		}
+		nonce := segmentNonce(r.nonce, r.index)
+		sealed := r.sealed[:n]
+		out, err := r.aead.Open(r.out, nonce, sealed, nil)
+		if err != nil {
+			out, err = r.aead.Open(r.out, nonce, sealed, encFinalAAD)
+			r.final = err == nil
+		}
+		if err != nil {
+			return 0, ErrCorrupt
+		}
+		r.out = out
+		r.index++
+		if r.skip > 0 {
+			r.pos = min(r.skip, len(r.out))
+			r.skip -= r.pos
+		}
+	}
+	if r.limit > 0 && int64(len(p)) > r.limit {
+		p = p[:r.limit]
+	}
+	n := copy(p, r.out[r.pos:])
+	r.pos += n
+	if r.limit > 0 {
+		r.limit -= int64(n)
+	}
+	return n, nil
+}
+
+// readCloser pairs a reader with the closer of the body it reads from.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKey(t *testing.T) []byte {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return key
+}
+
+func newTestKeyring(t *testing.T, keys ...[]byte) *Keyring {
+	ring, err := NewKeyring(keys)
+	require.NoError(t, err)
+	return ring
+}
+
+func readAll(t *testing.T, body io.ReadCloser) []byte {
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	return data
+}
+
+func TestEncryptedStorage(t *testing.T) {
+	testStorage(t, NewEncrypted(NewMemory(), newTestKeyring(t, newTestKey(t))))
+
+	ctx := context.Background()
+	inner := NewMemory()
+	store := NewEncrypted(inner, newTestKeyring(t, newTestKey(t)))
+
+	// Spans several segments and ends in a partial one
+	content := make([]byte, 3*encSegmentSize+100)
+	rand.Read(content)
+
+	t.Run("Store objects encrypted", func(t *testing.T) {
+		require.NoError(t, store.Put(ctx, "todos/1/secret.bin", bytes.NewReader(content), PutOptions{Size: int64(len(content))}))
+
+		raw, info, err := inner.Get(ctx, "todos/1/secret.bin")
+		require.NoError(t, err)
+		stored := readAll(t, raw)
+		assert.False(t, bytes.Contains(stored, content[:64]))
+		assert.Equal(t, int64(encHeaderSize)+encryptedSize(int64(len(content))), info.Size)
+
+		body, info, err := store.Get(ctx, "todos/1/secret.bin")
+		require.NoError(t, err)
+		assert.Equal(t, content, readAll(t, body))
+		assert.Equal(t, int64(len(content)), info.Size)
+
+		info, err = store.Stat(ctx, "todos/1/secret.bin")
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), info.Size)
+	})
+
+	t.Run("Read ranges across segments", func(t *testing.T) {
+		for _, r := range [][2]int64{
+			{0, 10},
+			{encSegmentSize - 5, 10},
+			{encSegmentSize, encSegmentSize},
+			{2*encSegmentSize + 7, -1},
+			{int64(len(content)) - 1, 1},
+		} {
+			body, err := store.GetRange(ctx, "todos/1/secret.bin", r[0], r[1])
+			require.NoError(t, err)
+			end := int64(len(content))
+			if r[1] >= 0 {
+				end = r[0] + r[1]
+			}
+			assert.Equal(t, content[r[0]:end], readAll(t, body), "range %v", r)
+		}
+	})
+
+	t.Run("Store empty objects", func(t *testing.T) {
+		require.NoError(t, store.Put(ctx, "todos/1/empty.txt", strings.NewReader(""), PutOptions{}))
+		body, info, err := store.Get(ctx, "todos/1/empty.txt")
+		require.NoError(t, err)
+		assert.Empty(t, readAll(t, body))
+		assert.Equal(t, int64(0), info.Size)
+	})
+
+	t.Run("Read objects stored before encryption", func(t *testing.T) {
+		require.NoError(t, inner.Put(ctx, "todos/1/legacy.txt", strings.NewReader("plain old text"), PutOptions{}))
+		body, info, err := store.Get(ctx, "todos/1/legacy.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "plain old text", string(readAll(t, body)))
+		assert.Equal(t, int64(14), info.Size)
+
+		body, err = store.GetRange(ctx, "todos/1/legacy.txt", 6, 3)
+		require.NoError(t, err)
+		assert.Equal(t, "old", string(readAll(t, body)))
+	})
+
+	t.Run("Detect tampering", func(t *testing.T) {
+		raw, _, _ := inner.Get(ctx, "todos/1/secret.bin")
+		stored := readAll(t, raw)
+		stored[encHeaderSize+10] ^= 1
+		require.NoError(t, inner.Put(ctx, "todos/1/tampered.bin", bytes.NewReader(stored), PutOptions{}))
+
+		body, _, err := store.Get(ctx, "todos/1/tampered.bin")
+		require.NoError(t, err)
+		_, err = io.ReadAll(body)
+		assert.ErrorIs(t, err, ErrCorrupt)
+	})
+
+	t.Run("Detect truncation at a segment boundary", func(t *testing.T) {
+		raw, _, _ := inner.Get(ctx, "todos/1/secret.bin")
+		stored := readAll(t, raw)
+		for _, segments := range []int{0, 2, 3} {
+			cut := encHeaderSize + segments*(encSegmentSize+encTagSize)
+			require.NoError(t, inner.Put(ctx, "todos/1/truncated.bin", bytes.NewReader(stored[:cut]), PutOptions{}))
+
+			body, _, err := store.Get(ctx, "todos/1/truncated.bin")
+			require.NoError(t, err)
+			_, err = io.ReadAll(body)
+			body.Close()
+			assert.ErrorIs(t, err, ErrCorrupt, "%d segments", segments)
+
+			body, err = store.GetRange(ctx, "todos/1/truncated.bin", 0, -1)
+			require.NoError(t, err)
+			_, err = io.ReadAll(body)
+			body.Close()
+			assert.ErrorIs(t, err, ErrCorrupt, "%d segments", segments)
+		}
+	})
+
+	t.Run("End multipart uploads of whole parts with a last segment", func(t *testing.T) {
+		part := make([]byte, MinPartSize)
+		rand.Read(part)
+		uploadID, err := store.CreateMultipartUpload(ctx, "uploads/whole.bin", PutOptions{})
+		require.NoError(t, err)
+		first, err := store.UploadPart(ctx, "uploads/whole.bin", uploadID, 1, bytes.NewReader(part), MinPartSize)
+		require.NoError(t, err)
+		require.NoError(t, store.CompleteMultipartUpload(ctx, "uploads/whole.bin", uploadID, []Part{first}))
+
+		body, info, err := store.Get(ctx, "uploads/whole.bin")
+		require.NoError(t, err)
+		assert.Equal(t, part, readAll(t, body))
+		assert.Equal(t, int64(MinPartSize), info.Size)
+	})
+
+	t.Run("Refuse presigned URLs", func(t *testing.T) {
+		_, err := store.PresignGet(ctx, "todos/1/secret.bin", 0, "")
+		assert.ErrorIs(t, err, ErrPresignUnsupported)
+	})
+}
+
+// bareListing lists objects without their metadata, like S3 does.
+type bareListing struct {
+	*MemoryStorage
+}
+
+func (b bareListing) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	return b.MemoryStorage.List(ctx, prefix, func(info ObjectInfo) error {
+		info.ContentType, info.ContentDisposition = "", ""
+		return fn(info)
+	})
+}
+
+func TestEncryptedStorageRotateKeys(t *testing.T) {
+	ctx := context.Background()
+	inner := bareListing{NewMemory()}
+	oldKey, newKey := newTestKey(t), newTestKey(t)
+
+	before := NewEncrypted(inner, newTestKeyring(t, oldKey))
+	require.NoError(t, before.Put(ctx, "todos/1/a.txt", strings.NewReader("first"), PutOptions{
+		ContentType:        "text/plain",
+		ContentDisposition: `attachment; filename="a.txt"`,
+	}))
+	require.NoError(t, before.Put(ctx, "todos/1/empty.txt", strings.NewReader(""), PutOptions{}))
+	require.NoError(t, inner.Put(ctx, "todos/1/legacy.txt", strings.NewReader("plain"), PutOptions{}))
+
+	// Rotating wraps every data key with the new master key
+	during := NewEncrypted(inner, newTestKeyring(t, newKey, oldKey))
+	require.NoError(t, during.Put(ctx, "todos/1/b.txt", strings.NewReader("second"), PutOptions{}))
+	rotated, err := during.RotateKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, rotated)
+
+	// Nothing is left to do the second time
+	rotated, err = during.RotateKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, rotated)
+
+	// The old key is no longer needed
+	after := NewEncrypted(inner, newTestKeyring(t, newKey))
+	for key, want := range map[string]string{
+		"todos/1/a.txt":      "first",
+		"todos/1/b.txt":      "second",
+		"todos/1/empty.txt":  "",
+		"todos/1/legacy.txt": "plain",
+	} {
+		body, _, err := after.Get(ctx, key)
+		require.NoError(t, err, key)
+		assert.Equal(t, want, string(readAll(t, body)), key)
+	}
+	info, err := inner.Stat(ctx, "todos/1/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", info.ContentType)
+	assert.Equal(t, `attachment; filename="a.txt"`, info.ContentDisposition)
+
+	_, _, err = NewEncrypted(inner, newTestKeyring(t, newTestKey(t))).Get(ctx, "todos/1/a.txt")
+	assert.ErrorContains(t, err, "unknown master key")
+}
+
+func TestLoadKeyring(t *testing.T) {
+	first, second := newTestKey(t), newTestKey(t)
+	encoded := base64.StdEncoding.EncodeToString(first) + "," + base64.StdEncoding.EncodeToString(second)
+
+	ring, err := LoadKeyring(encoded, "")
+	require.NoError(t, err)
+	assert.Equal(t, masterKeyID(first), ring.current)
+	assert.Len(t, ring.keys, 2)
+
+	path := filepath.Join(t.TempDir(), "keys")
+	file := "# current\n" + base64.StdEncoding.EncodeToString(second) + "\n\n# previous\n" + base64.StdEncoding.EncodeToString(first) + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(file), 0o600))
+	ring, err = LoadKeyring("", path)
+	require.NoError(t, err)
+	assert.Equal(t, masterKeyID(second), ring.current)
+
+	_, err = LoadKeyring(base64.StdEncoding.EncodeToString([]byte("too short")), "")
+	assert.Error(t, err)
+	_, err = LoadKeyring("not base64!", "")
+	assert.Error(t, err)
+	_, err = LoadKeyring("", filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"crypto/rand"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+)
+
+// maxFilenameLength caps sanitized filenames so keys stay well below the
+// 1024 byte limit S3 puts on them.
+const maxFilenameLength = 128
+
+// NewKey builds a unique object key below prefix for a client supplied
+// filename, e.g. "todos/12/<uuid>/report.pdf".
+func NewKey(prefix string, filename string) string {
+	return path.Join(prefix, newUUID(), SanitizeFilename(filename))
+}
+
+// SanitizeFilename reduces a client supplied filename to a safe key
+// segment: directories are stripped and anything outside letters, digits,
+// '.', '-' and '_' is replaced with '_'.
+func SanitizeFilename(filename string) string {
+	// Browsers on Windows may send the full path.
+	filename = filename[strings.LastIndexAny(filename, `/\`)+1:]
+
+	var b strings.Builder
+	for _, r := range filename {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	name := strings.TrimLeft(b.String(), ".")
+	if len(name) > maxFilenameLength {
+		ext := path.Ext(name)
+		if len(ext) > maxFilenameLength/2 {
+			ext = ""
+		}
+		name = name[:maxFilenameLength-len(ext)] + ext
+	}
+	if name == "" {
+		return "file"
+	}
+	return name
+}
+
+// ContentDisposition formats a Content-Disposition header of the given type
+// ("attachment" or "inline") that restores the original filename.
+func ContentDisposition(dispositionType string, filename string) string {
+	disposition := mime.FormatMediaType(dispositionType, map[string]string{"filename": filename})
+	if disposition == "" {
+		// The filename contained characters mime refuses to encode.
+		return mime.FormatMediaType(dispositionType, map[string]string{"filename": SanitizeFilename(filename)})
+	}
+	return disposition
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
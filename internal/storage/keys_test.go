@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := map[string]string{
+		"report.pdf":                      "report.pdf",
+		"../../etc/passwd":                "passwd",
+		`C:\Users\me\report.pdf`:          "report.pdf",
+		"my report (final).pdf":           "my_report__final_.pdf",
+		".env":                            "env",
+		"":                                "file",
+		"..":                              "file",
+		"résumé.txt":                      "r_sum_.txt",
+		strings.Repeat("a", 300) + ".pdf": strings.Repeat("a", 124) + ".pdf",
+	}
+	for input, want := range tests {
+		assert.Equal(t, want, SanitizeFilename(input), input)
+	}
+}
+
+func TestNewKey(t *testing.T) {
+	first := NewKey("todos/12", "../report.pdf")
+	second := NewKey("todos/12", "../report.pdf")
+
+	assert.NotEqual(t, first, second)
+	assert.Regexp(t, `^todos/12/[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}/report\.pdf$`, first)
+}
+
+func TestContentDisposition(t *testing.T) {
+	assert.Equal(t, `attachment; filename="my report.pdf"`, ContentDisposition("attachment", "my report.pdf"))
+	assert.Equal(t, `inline; filename*=utf-8''r%C3%A9sum%C3%A9.txt`, ContentDisposition("inline", "résumé.txt"))
+}
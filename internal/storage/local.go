@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalStorage stores objects as files below a directory on disk.
+type LocalStorage struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocal creates a store rooted at dir, creating the directory if needed.
+// Object URLs are built from baseURL; when it is empty they point at the
+// file on disk.
+func NewLocal(dir string, baseURL string) (*LocalStorage, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(absDir, 0o755); err != nil {
+		return nil, fmt.Errorf("storage: unable to create %s: %w", absDir, err)
+	}
+	if baseURL == "" {
+		baseURL = (&url.URL{Scheme: "file", Path: filepath.ToSlash(absDir)}).String()
+	}
+	return &LocalStorage{dir: absDir, baseURL: strings.TrimRight(baseURL, "/")}, nil
+}
+
+func (l *LocalStorage) Put(ctx context.Context, key string, body io.Reader, opts PutOptions) error {
+	filePath, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial object.
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+func (l *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	filePath, err := l.path(key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, ObjectInfo{}, translateFileError(err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, ObjectInfo{}, err
+	}
+	return file, l.info(key, stat), nil
+}
+
+func (l *LocalStorage) GetRange(ctx context.Context, key string, offset int64, length int64) (io.ReadCloser, error) {
+	filePath, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, translateFileError(err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, nil
+}
+
+func (l *LocalStorage) Copy(ctx context.Context, src string, dst string) error {
+	body, _, err := l.Get(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return l.Put(ctx, dst, body, PutOptions{})
+}
+
+func (l *LocalStorage) Delete(ctx context.Context, key string) error {
+	filePath, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *LocalStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	filePath, err := l.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return ObjectInfo{}, translateFileError(err)
+	}
+	return l.info(key, stat), nil
+}
+
+func (l *LocalStorage) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	return filepath.WalkDir(l.dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && filePath == filepath.Join(l.dir, multipartDir) {
+			return fs.SkipDir
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(l.dir, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return fn(l.info(key, stat))
+	})
+}
+
+func (l *LocalStorage) URL(key string) string {
+	return l.baseURL + "/" + key
+}
+
+// PresignGet always fails with ErrPresignUnsupported: whatever serves the
+// directory cannot check an expiry, so a URL would grant access for good.
+func (l *LocalStorage) PresignGet(ctx context.Context, key string, ttl time.Duration, contentDisposition string) (string, error) {
+	return "", ErrPresignUnsupported
+}
+
+// multipartDir holds the parts of unfinished multipart uploads, one
+// directory per upload, below the storage directory.
+const multipartDir = ".multipart"
+
+func (l *LocalStorage) CreateMultipartUpload(ctx context.Context, key string, opts PutOptions) (string, error) {
+	if _, err := l.path(key); err != nil {
+		return "", err
+	}
+	uploadID := newUUID()
+	dir := filepath.Join(l.dir, multipartDir, uploadID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "key"), []byte(key), 0o644); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return uploadID, nil
+}
+
+func (l *LocalStorage) UploadPart(ctx context.Context, key string, uploadID string, number int, body io.Reader, size int64) (Part, error) {
+	dir, err := l.uploadDir(key, uploadID)
+	if err != nil {
+		return Part{}, err
+	}
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return Part{}, err
+	}
+	defer os.Remove(tmp.Name())
+	hash := md5.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), body); err != nil {
+		tmp.Close()
+		return Part{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return Part{}, err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, strconv.Itoa(number))); err != nil {
+		return Part{}, err
+	}
+	return Part{Number: number, ETag: `"` + hex.EncodeToString(hash.Sum(nil)) + `"`}, nil
+}
+
+func (l *LocalStorage) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []Part) error {
+	dir, err := l.uploadDir(key, uploadID)
+	if err != nil {
+		return err
+	}
+	files := make([]io.Reader, 0, len(parts))
+	for i, part := range parts {
+		file, err := os.Open(filepath.Join(dir, strconv.Itoa(part.Number)))
+		if err != nil {
+			return fmt.Errorf("storage: part %d of upload %s: %w", part.Number, uploadID, err)
+		}
+		defer file.Close()
+		stat, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		if i < len(parts)-1 && stat.Size() < MinPartSize {
+			return fmt.Errorf("storage: part %d of upload %s is too small", part.Number, uploadID)
+		}
+		files = append(files, file)
+	}
+	if err := l.Put(ctx, key, io.MultiReader(files...), PutOptions{}); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func (l *LocalStorage) AbortMultipartUpload(ctx context.Context, key string, uploadID string) error {
+	dir, err := l.uploadDir(key, uploadID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// uploadDir returns the directory holding the parts of a multipart upload
+// of key.
+func (l *LocalStorage) uploadDir(key string, uploadID string) (string, error) {
+	if uploadID == "" || uploadID != filepath.Base(uploadID) || strings.HasPrefix(uploadID, ".") {
+		return "", ErrNotFound
+	}
+	dir := filepath.Join(l.dir, multipartDir, uploadID)
+	stored, err := os.ReadFile(filepath.Join(dir, "key"))
+	if err != nil {
+		return "", translateFileError(err)
+	}
+	if string(stored) != key {
+		return "", ErrNotFound
+	}
+	return dir, nil
+}
+
+// path maps key onto a file below the storage directory, rejecting keys
+// that would resolve outside of it.
+func (l *LocalStorage) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if key == "" || cleaned == "/" || cleaned[1:] != key || strings.HasPrefix(key, multipartDir+"/") {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
+
+func (l *LocalStorage) info(key string, stat fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          key,
+		Size:         stat.Size(),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		ETag:         fmt.Sprintf(`"%x-%x"`, stat.ModTime().UnixNano(), stat.Size()),
+		LastModified: stat.ModTime(),
+	}
+}
+
+func translateFileError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
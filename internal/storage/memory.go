@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStorage keeps objects in memory. It is meant for development and
+// tests; nothing survives a restart.
+type MemoryStorage struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+	uploads map[string]*memoryUpload
+}
+
+type memoryUpload struct {
+	key   string
+	opts  PutOptions
+	parts map[int][]byte
+}
+
+type memoryObject struct {
+	data []byte
+	info ObjectInfo
+}
+
+// NewMemory creates an empty in-memory store.
+func NewMemory() *MemoryStorage {
+	return &MemoryStorage{
+		objects: make(map[string]memoryObject),
+		uploads: make(map[string]*memoryUpload),
+	}
+}
+
+func (m *MemoryStorage) Put(ctx context.Context, key string, body io.Reader, opts PutOptions) error {
+	if key == "" {
+		return ErrInvalidKey
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	sum := md5.Sum(data)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = memoryObject{
+		data: data,
+		info: ObjectInfo{
+			Key:                key,
+			Size:               int64(len(data)),
+			ContentType:        opts.ContentType,
+			ContentDisposition: opts.ContentDisposition,
+			ETag:               `"` + hex.EncodeToString(sum[:]) + `"`,
+			LastModified:       time.Now(),
+		},
+	}
+	return nil
+}
+
+func (m *MemoryStorage) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	object, ok := m.objects[key]
+	if !ok {
+		return nil, ObjectInfo{}, ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(object.data)), object.info, nil
+}
+
+func (m *MemoryStorage) GetRange(ctx context.Context, key string, offset int64, length int64) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	object, ok := m.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	data := object.data[min(offset, int64(len(object.data))):]
+	if length >= 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *MemoryStorage) Copy(ctx context.Context, src string, dst string) error {
+	if dst == "" {
+		return ErrInvalidKey
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	object, ok := m.objects[src]
+	if !ok {
+		return ErrNotFound
+	}
+	object.info.Key = dst
+	object.info.LastModified = time.Now()
+	m.objects[dst] = object
+	return nil
+}
+
+func (m *MemoryStorage) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *MemoryStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	object, ok := m.objects[key]
+	if !ok {
+		return ObjectInfo{}, ErrNotFound
+	}
+	return object.info, nil
+}
+
+func (m *MemoryStorage) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	m.mu.RLock()
+	var infos []ObjectInfo
+	for key, object := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			infos = append(infos, object.info)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	for _, info := range infos {
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStorage) URL(key string) string {
+	return "memory://" + key
+}
+
+// PresignGet always fails with ErrPresignUnsupported: memory:// URLs
+// neither expire nor lead anywhere outside the process.
+func (m *MemoryStorage) PresignGet(ctx context.Context, key string, ttl time.Duration, contentDisposition string) (string, error) {
+	return "", ErrPresignUnsupported
+}
+
+func (m *MemoryStorage) CreateMultipartUpload(ctx context.Context, key string, opts PutOptions) (string, error) {
+	if key == "" {
+		return "", ErrInvalidKey
+	}
+	uploadID := newUUID()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.uploads[uploadID] = &memoryUpload{key: key, opts: opts, parts: make(map[int][]byte)}
+	return uploadID, nil
+}
+
+func (m *MemoryStorage) UploadPart(ctx context.Context, key string, uploadID string, number int, body io.Reader, size int64) (Part, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return Part{}, err
+	}
+	sum := md5.Sum(data)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	upload, ok := m.uploads[uploadID]
+	if !ok || upload.key != key {
+		return Part{}, ErrNotFound
+	}
+	upload.parts[number] = data
+	return Part{Number: number, ETag: `"` + hex.EncodeToString(sum[:]) + `"`}, nil
+}
+
+func (m *MemoryStorage) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []Part) error {
+	m.mu.Lock()
+	upload, ok := m.uploads[uploadID]
+	if !ok || upload.key != key {
+		m.mu.Unlock()
+		return ErrNotFound
+	}
+	var buf bytes.Buffer
+	for i, part := range parts {
+		data, ok := upload.parts[part.Number]
+		if !ok {
+			m.mu.Unlock()
+			return fmt.Errorf("storage: part %d of upload %s is missing", part.Number, uploadID)
+		}
+		if i < len(parts)-1 && len(data) < MinPartSize {
+			m.mu.Unlock()
+			return fmt.Errorf("storage: part %d of upload %s is too small", part.Number, uploadID)
+		}
+		buf.Write(data)
+	}
+	delete(m.uploads, uploadID)
+	m.mu.Unlock()
+	return m.Put(ctx, key, &buf, upload.opts)
+}
+
+func (m *MemoryStorage) AbortMultipartUpload(ctx context.Context, key string, uploadID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.uploads, uploadID)
+	return nil
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ObjectReader reads an object of known size through ranged gets, so it can
+// seek without downloading what it skips. It satisfies io.ReadSeeker, which
+// lets http.ServeContent answer Range requests straight from storage.
+type ObjectReader struct {
+	ctx    context.Context
+	store  Storage
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+// NewObjectReader returns a reader over the size bytes stored under key.
+// Nothing is fetched until the first Read.
+func NewObjectReader(ctx context.Context, store Storage, key string, size int64) *ObjectReader {
+	return &ObjectReader{ctx: ctx, store: store, key: key, size: size}
+}
+
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.store.GetRange(r.ctx, r.key, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("storage: negative seek position")
+	}
+	if offset != r.offset {
+		r.closeBody()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+// Close releases the open ranged read, if any.
+func (r *ObjectReader) Close() error {
+	r.closeBody()
+	return nil
+}
+
+func (r *ObjectReader) closeBody() {
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+}
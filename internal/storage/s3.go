@@ -0,0 +1,351 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3Config holds the settings needed to reach an S3 bucket or an
+// S3-compatible service such as MinIO.
+type S3Config struct {
+	Bucket string
+	Region string
+
+	// AccessKeyID and SecretAccessKey are optional. When both are empty the
+	// SDK's default credential chain (environment, shared profile, IMDS) is
+	// used instead.
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// Endpoint overrides the AWS endpoint, e.g. "http://minio:9000".
+	Endpoint string
+	// UsePathStyle addresses objects as endpoint/bucket/key instead of
+	// bucket.endpoint/key. Most S3-compatible services need it.
+	UsePathStyle bool
+	// PublicURL overrides the base URL objects are reported under.
+	PublicURL string
+}
+
+// defaultRegion is used for S3-compatible endpoints that don't care about
+// the region but still need one to sign requests.
+const defaultRegion = "us-east-1"
+
+// S3Storage stores objects in an S3 bucket.
+type S3Storage struct {
+	client    *s3.Client
+	presigner *s3.PresignClient
+	uploader  *manager.Uploader
+	bucket    string
+	baseURL   *url.URL
+}
+
+// NewS3 creates an S3 backed store.
+func NewS3(ctx context.Context, cfg S3Config) (*S3Storage, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("storage: S3 bucket name not set")
+	}
+	region := cfg.Region
+	if region == "" {
+		if cfg.Endpoint == "" {
+			return nil, errors.New("storage: AWS region not set")
+		}
+		region = defaultRegion
+	}
+
+	opts := []func(*config.LoadOptions) error{config.WithRegion(region)}
+	switch {
+	case cfg.AccessKeyID != "" && cfg.SecretAccessKey != "":
+		opts = append(opts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		))
+	case cfg.AccessKeyID != "" || cfg.SecretAccessKey != "":
+		return nil, errors.New("storage: both AWS access key ID and secret access key must be set")
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("storage: unable to load SDK config: %w", err)
+	}
+
+	baseURL, err := s3BaseURL(cfg, region)
+	if err != nil {
+		return nil, err
+	}
+
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+		o.UsePathStyle = cfg.UsePathStyle
+	})
+	return &S3Storage{
+		client:    client,
+		presigner: s3.NewPresignClient(client),
+		uploader:  manager.NewUploader(client),
+		bucket:    cfg.Bucket,
+		baseURL:   baseURL,
+	}, nil
+}
+
+// s3BaseURL works out the URL of the bucket root from the configured
+// endpoint and addressing style.
+func s3BaseURL(cfg S3Config, region string) (*url.URL, error) {
+	if cfg.PublicURL != "" {
+		return parseBaseURL(cfg.PublicURL)
+	}
+
+	endpoint := fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	if cfg.Endpoint != "" {
+		endpoint = cfg.Endpoint
+	}
+	base, err := parseBaseURL(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.UsePathStyle {
+		base.Path += "/" + cfg.Bucket
+	} else {
+		base.Host = cfg.Bucket + "." + base.Host
+	}
+	return base, nil
+}
+
+func parseBaseURL(raw string) (*url.URL, error) {
+	base, err := url.Parse(raw)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("storage: invalid URL %q", raw)
+	}
+	base.Path = strings.TrimRight(base.Path, "/")
+	return base, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, body io.Reader, opts PutOptions) error {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	}
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if opts.ContentDisposition != "" {
+		input.ContentDisposition = aws.String(opts.ContentDisposition)
+	}
+	_, err := s.uploader.Upload(ctx, input)
+	return err
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, ObjectInfo{}, translateS3Error(err)
+	}
+	return out.Body, ObjectInfo{
+		Key:                key,
+		Size:               aws.ToInt64(out.ContentLength),
+		ContentType:        aws.ToString(out.ContentType),
+		ContentDisposition: aws.ToString(out.ContentDisposition),
+		ETag:               aws.ToString(out.ETag),
+		LastModified:       aws.ToTime(out.LastModified),
+	}, nil
+}
+
+func (s *S3Storage) GetRange(ctx context.Context, key string, offset int64, length int64) (io.ReadCloser, error) {
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length >= 0 {
+		if length == 0 {
+			return io.NopCloser(strings.NewReader("")), nil
+		}
+		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(byteRange),
+	})
+	if err != nil {
+		return nil, translateS3Error(err)
+	}
+	return out.Body, nil
+}
+
+// Copy has S3 copy the object server side. A single CopyObject handles
+// objects of up to 5 GB, well above the upload limits.
+func (s *S3Storage) Copy(ctx context.Context, src string, dst string) error {
+	source := url.URL{Path: s.bucket + "/" + src}
+	_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s.bucket),
+		Key:        aws.String(dst),
+		CopySource: aws.String(source.EscapedPath()),
+	})
+	return translateS3Error(err)
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (s *S3Storage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return ObjectInfo{}, translateS3Error(err)
+	}
+	return ObjectInfo{
+		Key:                key,
+		Size:               aws.ToInt64(out.ContentLength),
+		ContentType:        aws.ToString(out.ContentType),
+		ContentDisposition: aws.ToString(out.ContentDisposition),
+		ETag:               aws.ToString(out.ETag),
+		LastModified:       aws.ToTime(out.LastModified),
+	}, nil
+}
+
+func (s *S3Storage) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, object := range page.Contents {
+			err := fn(ObjectInfo{
+				Key:          aws.ToString(object.Key),
+				Size:         aws.ToInt64(object.Size),
+				ETag:         aws.ToString(object.ETag),
+				LastModified: aws.ToTime(object.LastModified),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *S3Storage) URL(key string) string {
+	objectURL := *s.baseURL
+	objectURL.Path += "/" + key
+	return objectURL.String()
+}
+
+func (s *S3Storage) PresignGet(ctx context.Context, key string, ttl time.Duration, contentDisposition string) (string, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	if contentDisposition != "" {
+		input.ResponseContentDisposition = aws.String(contentDisposition)
+	}
+	req, err := s.presigner.PresignGetObject(ctx, input, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
+// CreateMultipartUpload starts an S3 multipart upload. Content type and
+// disposition are set here, as the assembled object takes them from the
+// upload rather than its parts.
+func (s *S3Storage) CreateMultipartUpload(ctx context.Context, key string, opts PutOptions) (string, error) {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if opts.ContentDisposition != "" {
+		input.ContentDisposition = aws.String(opts.ContentDisposition)
+	}
+	output, err := s.client.CreateMultipartUpload(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(output.UploadId), nil
+}
+
+// UploadPart sends one part of a multipart upload. S3 wants its size up
+// front, so body must hold exactly size bytes.
+func (s *S3Storage) UploadPart(ctx context.Context, key string, uploadID string, number int, body io.Reader, size int64) (Part, error) {
+	output, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int32(int32(number)),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return Part{}, translateS3Error(err)
+	}
+	return Part{Number: number, ETag: aws.ToString(output.ETag)}, nil
+}
+
+// CompleteMultipartUpload has S3 assemble the listed parts into the object.
+func (s *S3Storage) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []Part) error {
+	completed := make([]types.CompletedPart, len(parts))
+	for i, part := range parts {
+		completed[i] = types.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int32(int32(part.Number)),
+		}
+	}
+	_, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	return translateS3Error(err)
+}
+
+// AbortMultipartUpload discards the parts of a multipart upload. Aborting
+// an upload S3 no longer knows is not an error.
+func (s *S3Storage) AbortMultipartUpload(ctx context.Context, key string, uploadID string) error {
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	if err = translateS3Error(err); errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// translateS3Error maps S3's missing-object and missing-upload errors onto
+// ErrNotFound.
+func translateS3Error(err error) error {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	var noSuchUpload *types.NoSuchUpload
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) || errors.As(err, &noSuchUpload) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3URL(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  S3Config
+		want string
+	}{
+		{
+			name: "AWS virtual-hosted style",
+			cfg:  S3Config{Bucket: "todos", Region: "eu-west-1"},
+			want: "https://todos.s3.eu-west-1.amazonaws.com/todos/1/report.pdf",
+		},
+		{
+			name: "AWS path style",
+			cfg:  S3Config{Bucket: "todos", Region: "eu-west-1", UsePathStyle: true},
+			want: "https://s3.eu-west-1.amazonaws.com/todos/todos/1/report.pdf",
+		},
+		{
+			name: "MinIO endpoint with path style",
+			cfg:  S3Config{Bucket: "todos", Endpoint: "http://minio:9000/", UsePathStyle: true},
+			want: "http://minio:9000/todos/todos/1/report.pdf",
+		},
+		{
+			name: "Public URL override",
+			cfg:  S3Config{Bucket: "todos", Endpoint: "http://minio:9000", PublicURL: "https://cdn.example.com/files"},
+			want: "https://cdn.example.com/files/todos/1/report.pdf",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewS3(context.Background(), tt.cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, store.URL("todos/1/report.pdf"))
+		})
+	}
+}
+
+func TestNewS3Validation(t *testing.T) {
+	_, err := NewS3(context.Background(), S3Config{Region: "eu-west-1"})
+	assert.Error(t, err, "bucket is required")
+
+	_, err = NewS3(context.Background(), S3Config{Bucket: "todos"})
+	assert.Error(t, err, "region is required without an endpoint")
+
+	_, err = NewS3(context.Background(), S3Config{Bucket: "todos", Region: "eu-west-1", AccessKeyID: "key"})
+	assert.Error(t, err, "static credentials need both halves")
+
+	_, err = NewS3(context.Background(), S3Config{Bucket: "todos", Endpoint: "minio:9000"})
+	assert.Error(t, err, "endpoint needs a scheme")
+}
+
+func TestS3PresignGet(t *testing.T) {
+	store, err := NewS3(context.Background(), S3Config{
+		Bucket:          "todos",
+		Endpoint:        "http://minio:9000",
+		UsePathStyle:    true,
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+	})
+	require.NoError(t, err)
+
+	signed, err := store.PresignGet(context.Background(), "todos/1/report.pdf", 5*time.Minute, `attachment; filename="report.pdf"`)
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "minio:9000", parsed.Host)
+	assert.Equal(t, "/todos/todos/1/report.pdf", parsed.Path)
+	assert.Equal(t, "300", parsed.Query().Get("X-Amz-Expires"))
+	assert.NotEmpty(t, parsed.Query().Get("X-Amz-Signature"))
+	assert.Equal(t, `attachment; filename="report.pdf"`, parsed.Query().Get("response-content-disposition"))
+}
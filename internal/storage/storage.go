@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrNotFound is returned when the requested object does not exist.
+var ErrNotFound = errors.New("storage: object not found")
+
+// ErrInvalidKey is returned for keys that cannot be stored safely, such as
+// keys that would escape the storage root.
+var ErrInvalidKey = errors.New("storage: invalid key")
+
+// Storage is the blob store that holds todo attachments.
+type Storage interface {
+	// Put stores the body under key, replacing any existing object.
+	Put(ctx context.Context, key string, body io.Reader, opts PutOptions) error
+	// Get opens the object stored under key. The caller must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	// GetRange opens length bytes of the object starting at offset, or
+	// everything from offset on when length is negative. The caller must
+	// close it.
+	GetRange(ctx context.Context, key string, offset int64, length int64) (io.ReadCloser, error)
+	// Copy duplicates the object stored under src to dst, with its
+	// metadata, without passing the content through the caller.
+	Copy(ctx context.Context, src string, dst string) error
+	// Delete removes the object stored under key. Deleting a missing object
+	// is not an error.
+	Delete(ctx context.Context, key string) error
+	// Stat returns the metadata of the object stored under key.
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// List calls fn for every object whose key starts with prefix, in key
+	// order. Listing stops at the first error fn returns.
+	List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+	// URL returns the address clients can use to reach the object.
+	URL(key string) string
+	// PresignGet returns a URL granting read access to the object for ttl.
+	// contentDisposition, when set, overrides the header stored with the
+	// object. Backends that cannot sign expiring URLs, or must not expose
+	// objects directly, fail with ErrPresignUnsupported.
+	PresignGet(ctx context.Context, key string, ttl time.Duration, contentDisposition string) (string, error)
+
+	// CreateMultipartUpload starts an upload of key whose content arrives
+	// in numbered parts and returns its ID. Every part but the last must be
+	// at least MinPartSize bytes. Nothing is visible under key before the
+	// upload is completed.
+	CreateMultipartUpload(ctx context.Context, key string, opts PutOptions) (string, error)
+	// UploadPart stores part number (counting from 1) of a multipart upload.
+	UploadPart(ctx context.Context, key string, uploadID string, number int, body io.Reader, size int64) (Part, error)
+	// CompleteMultipartUpload assembles the given parts, in order, into the
+	// object stored under key.
+	CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []Part) error
+	// AbortMultipartUpload discards a multipart upload and its parts.
+	// Aborting an unknown upload is not an error.
+	AbortMultipartUpload(ctx context.Context, key string, uploadID string) error
+}
+
+// MinPartSize is the smallest part a multipart upload accepts, except for
+// its last part. It matches the S3 limit.
+const MinPartSize = 5 << 20
+
+// Part identifies an uploaded part of a multipart upload.
+type Part struct {
+	Number int    `json:"number"`
+	ETag   string `json:"etag"`
+}
+
+// PutOptions carries the optional metadata stored alongside an object.
+type PutOptions struct {
+	ContentType string
+	Size        int64
+	// ContentDisposition is served back on download, typically to restore
+	// the original filename.
+	ContentDisposition string
+}
+
+// ObjectInfo describes a stored object. List may leave the content type
+// and disposition empty; Get and Stat fill in what the backend keeps.
+type ObjectInfo struct {
+	Key                string
+	Size               int64
+	ContentType        string
+	ContentDisposition string
+	ETag               string
+	LastModified       time.Time
+}
+
+// Config selects and configures a storage backend.
+type Config struct {
+	// Backend is one of "s3", "local" or "memory".
+	Backend string
+
+	LocalDir     string
+	LocalBaseURL string
+
+	S3 S3Config
+
+	// EncryptionKeys are base64 encoded master keys, separated by commas,
+	// the current one first. When they or EncryptionKeyFile are set,
+	// objects are encrypted before they reach the backend.
+	EncryptionKeys string
+	// EncryptionKeyFile names a file with one master key per line, used
+	// when EncryptionKeys is empty.
+	EncryptionKeyFile string
+}
+
+// ConfigFromEnv reads the storage configuration from environment variables.
+// The backend defaults to S3 to match earlier deployments.
+func ConfigFromEnv() Config {
+	return Config{
+		Backend:      getEnv("STORAGE_BACKEND", "s3"),
+		LocalDir:     getEnv("STORAGE_LOCAL_DIR", "uploads"),
+		LocalBaseURL: os.Getenv("STORAGE_LOCAL_BASE_URL"),
+		S3: S3Config{
+			Bucket:          os.Getenv("AWS_S3_BUCKET_NAME"),
+			Region:          os.Getenv("AWS_REGION"),
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			Endpoint:        os.Getenv("AWS_S3_ENDPOINT"),
+			UsePathStyle:    getEnvBool("AWS_S3_USE_PATH_STYLE", false),
+			PublicURL:       os.Getenv("AWS_S3_PUBLIC_URL"),
+		},
+		EncryptionKeys:    os.Getenv("STORAGE_ENCRYPTION_KEYS"),
+		EncryptionKeyFile: os.Getenv("STORAGE_ENCRYPTION_KEY_FILE"),
+	}
+}
+
+// New builds the backend selected by cfg, encrypting it when keys are
+// configured.
+func New(ctx context.Context, cfg Config) (Storage, error) {
+	store, err := newBackend(ctx, cfg)
+	if err != nil || (cfg.EncryptionKeys == "" && cfg.EncryptionKeyFile == "") {
+		return store, err
+	}
+	keys, err := LoadKeyring(cfg.EncryptionKeys, cfg.EncryptionKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewEncrypted(store, keys), nil
+}
+
+func newBackend(ctx context.Context, cfg Config) (Storage, error) {
+	switch cfg.Backend {
+	case "s3":
+		return NewS3(ctx, cfg.S3)
+	case "local":
+		return NewLocal(cfg.LocalDir, cfg.LocalBaseURL)
+	case "memory":
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("storage: unknown backend %q", cfg.Backend)
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStorage runs the behaviour every backend has to share.
+func testStorage(t *testing.T, store Storage) {
+	ctx := context.Background()
+
+	t.Run("Put and Get an object", func(t *testing.T) {
+		err := store.Put(ctx, "todos/1/report.txt", strings.NewReader("hello"), PutOptions{ContentType: "text/plain"})
+		require.NoError(t, err)
+
+		body, info, err := store.Get(ctx, "todos/1/report.txt")
+		require.NoError(t, err)
+		defer body.Close()
+		data, _ := io.ReadAll(body)
+		assert.Equal(t, "hello", string(data))
+		assert.Equal(t, int64(5), info.Size)
+		assert.NotEmpty(t, info.ETag)
+	})
+
+	t.Run("Get a range of an object", func(t *testing.T) {
+		body, err := store.GetRange(ctx, "todos/1/report.txt", 1, 3)
+		require.NoError(t, err)
+		data, _ := io.ReadAll(body)
+		body.Close()
+		assert.Equal(t, "ell", string(data))
+
+		body, err = store.GetRange(ctx, "todos/1/report.txt", 2, -1)
+		require.NoError(t, err)
+		data, _ = io.ReadAll(body)
+		body.Close()
+		assert.Equal(t, "llo", string(data))
+	})
+
+	t.Run("Seek through an object", func(t *testing.T) {
+		reader := NewObjectReader(ctx, store, "todos/1/report.txt", 5)
+		defer reader.Close()
+
+		end, err := reader.Seek(0, io.SeekEnd)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), end)
+
+		reader.Seek(3, io.SeekStart)
+		data, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, "lo", string(data))
+
+		reader.Seek(0, io.SeekStart)
+		data, _ = io.ReadAll(io.LimitReader(reader, 2))
+		assert.Equal(t, "he", string(data))
+	})
+
+	t.Run("Stat an object", func(t *testing.T) {
+		info, err := store.Stat(ctx, "todos/1/report.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "todos/1/report.txt", info.Key)
+		assert.Equal(t, int64(5), info.Size)
+	})
+
+	t.Run("List objects by prefix", func(t *testing.T) {
+		require.NoError(t, store.Put(ctx, "todos/2/other.txt", strings.NewReader("other"), PutOptions{}))
+		require.NoError(t, store.Put(ctx, "thumbs/1.png", strings.NewReader("png"), PutOptions{}))
+		defer store.Delete(ctx, "todos/2/other.txt")
+		defer store.Delete(ctx, "thumbs/1.png")
+
+		var keys []string
+		err := store.List(ctx, "todos/", func(info ObjectInfo) error {
+			keys = append(keys, info.Key)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"todos/1/report.txt", "todos/2/other.txt"}, keys)
+	})
+
+	t.Run("Copy an object", func(t *testing.T) {
+		require.NoError(t, store.Copy(ctx, "todos/1/report.txt", "todos/3/report.txt"))
+		defer store.Delete(ctx, "todos/3/report.txt")
+
+		body, info, err := store.Get(ctx, "todos/3/report.txt")
+		require.NoError(t, err)
+		data, _ := io.ReadAll(body)
+		body.Close()
+		assert.Equal(t, "hello", string(data))
+		assert.Equal(t, int64(5), info.Size)
+
+		err = store.Copy(ctx, "todos/1/missing.txt", "todos/3/missing.txt")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Delete an object", func(t *testing.T) {
+		require.NoError(t, store.Delete(ctx, "todos/1/report.txt"))
+		_, err := store.Stat(ctx, "todos/1/report.txt")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, _, err = store.Get(ctx, "todos/1/report.txt")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// Deleting twice is fine
+		assert.NoError(t, store.Delete(ctx, "todos/1/report.txt"))
+	})
+
+	t.Run("Assemble a multipart upload", func(t *testing.T) {
+		first := strings.Repeat("a", MinPartSize)
+		uploadID, err := store.CreateMultipartUpload(ctx, "uploads/big.bin", PutOptions{})
+		require.NoError(t, err)
+
+		// Parts may arrive out of order
+		second, err := store.UploadPart(ctx, "uploads/big.bin", uploadID, 2, strings.NewReader("tail"), 4)
+		require.NoError(t, err)
+		part, err := store.UploadPart(ctx, "uploads/big.bin", uploadID, 1, strings.NewReader(first), int64(len(first)))
+		require.NoError(t, err)
+
+		// Nothing is visible before the upload completes
+		var keys []string
+		store.List(ctx, "", func(info ObjectInfo) error {
+			keys = append(keys, info.Key)
+			return nil
+		})
+		assert.NotContains(t, keys, "uploads/big.bin")
+
+		require.NoError(t, store.CompleteMultipartUpload(ctx, "uploads/big.bin", uploadID, []Part{part, second}))
+		info, err := store.Stat(ctx, "uploads/big.bin")
+		require.NoError(t, err)
+		assert.Equal(t, int64(MinPartSize+4), info.Size)
+		body, err := store.GetRange(ctx, "uploads/big.bin", MinPartSize-1, -1)
+		require.NoError(t, err)
+		data, _ := io.ReadAll(body)
+		body.Close()
+		assert.Equal(t, "atail", string(data))
+		require.NoError(t, store.Delete(ctx, "uploads/big.bin"))
+	})
+
+	t.Run("Abort a multipart upload", func(t *testing.T) {
+		uploadID, err := store.CreateMultipartUpload(ctx, "uploads/aborted.bin", PutOptions{})
+		require.NoError(t, err)
+		_, err = store.UploadPart(ctx, "uploads/aborted.bin", uploadID, 1, strings.NewReader("x"), 1)
+		require.NoError(t, err)
+		require.NoError(t, store.AbortMultipartUpload(ctx, "uploads/aborted.bin", uploadID))
+
+		_, err = store.UploadPart(ctx, "uploads/aborted.bin", uploadID, 2, strings.NewReader("y"), 1)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, store.AbortMultipartUpload(ctx, "uploads/aborted.bin", uploadID))
+	})
+
+	t.Run("URL contains the key", func(t *testing.T) {
+		assert.True(t, strings.HasSuffix(store.URL("todos/1/report.txt"), "/todos/1/report.txt"))
+	})
+}
+
+func TestMemoryStorage(t *testing.T) {
+	store := NewMemory()
+	testStorage(t, store)
+
+	t.Run("Refuse presigned URLs", func(t *testing.T) {
+		_, err := store.PresignGet(context.Background(), "todos/1/report.txt", time.Minute, "")
+		assert.ErrorIs(t, err, ErrPresignUnsupported)
+	})
+}
+
+func TestLocalStorage(t *testing.T) {
+	store, err := NewLocal(t.TempDir(), "http://localhost:8080/files")
+	require.NoError(t, err)
+	testStorage(t, store)
+
+	t.Run("Refuse presigned URLs", func(t *testing.T) {
+		_, err := store.PresignGet(context.Background(), "todos/1/report.txt", time.Minute, "")
+		assert.ErrorIs(t, err, ErrPresignUnsupported)
+	})
+
+	t.Run("Reject keys escaping the directory", func(t *testing.T) {
+		for _, key := range []string{"", "../secret", "a/../../secret", "/etc/passwd", "a//b"} {
+			err := store.Put(context.Background(), key, strings.NewReader("x"), PutOptions{})
+			assert.ErrorIs(t, err, ErrInvalidKey, key)
+		}
+	})
+}
+
+func TestNewUnknownBackend(t *testing.T) {
+	_, err := New(context.Background(), Config{Backend: "ftp"})
+	assert.Error(t, err)
+}
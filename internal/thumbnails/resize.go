@@ -0,0 +1,68 @@
+package thumbnails
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Resize scales src down to fit a maxSize square, keeping its aspect ratio.
+// Every target pixel averages the source pixels it covers, which keeps
+// fine detail from aliasing. Images that already fit are only converted to
+// RGBA. An RGBA source is read in place, and returned as it is when it
+// fits, so callers making several sizes need to convert only once.
+func Resize(src image.Image, maxSize int) *image.RGBA {
+	rgba := toRGBA(src)
+	bounds := rgba.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	dstWidth, dstHeight := width, height
+	if width > maxSize || height > maxSize {
+		if width >= height {
+			dstWidth, dstHeight = maxSize, max(height*maxSize/width, 1)
+		} else {
+			dstWidth, dstHeight = max(width*maxSize/height, 1), maxSize
+		}
+	}
+
+	if dstWidth == width && dstHeight == height {
+		return rgba
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0 := y * height / dstHeight
+		y1 := max((y+1)*height/dstHeight, y0+1)
+		for x := 0; x < dstWidth; x++ {
+			x0 := x * width / dstWidth
+			x1 := max((x+1)*width/dstWidth, x0+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[rgba.PixOffset(bounds.Min.X, bounds.Min.Y+sy):]
+				for sx := x0; sx < x1; sx++ {
+					pixel := row[sx*4 : sx*4+4]
+					r += uint64(pixel[0])
+					g += uint64(pixel[1])
+					b += uint64(pixel[2])
+					a += uint64(pixel[3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// toRGBA returns src as an RGBA image, converting it only if it is not one.
+func toRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok {
+		return rgba
+	}
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	return rgba
+}
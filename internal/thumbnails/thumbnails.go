@@ -0,0 +1,364 @@
+package thumbnails
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"todo-app/internal/cleanup"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+)
+
+// Types lists the media types thumbnails are generated for. They are
+// decoded with the standard library only.
+var Types = []string{"image/png", "image/jpeg", "image/gif"}
+
+// errUnusable marks attachments no thumbnail can be made of, such as
+// broken or oversized images. They are not retried.
+var errUnusable = errors.New("thumbnails: unusable image")
+
+// batchSize is how many attachments the worker claims at a time.
+const batchSize = 10
+
+// maxAttempts is how often the worker tries an attachment whose thumbnails
+// fail for other reasons, such as storage errors, before giving up on it.
+const maxAttempts = 5
+
+// claimTimeout is how long an attachment stays claimed by a worker before
+// another one may take it over.
+const claimTimeout = 15 * time.Minute
+
+// statusProcessing marks attachments a worker has claimed.
+const statusProcessing = "processing"
+
+// abandonAfter is how long a thumbnail object may stay unclaimed before the
+// cleanup worker deletes it, in case its thumbnails fail to be saved.
+const abandonAfter = time.Hour
+
+// jpegQuality is used for thumbnails of opaque images.
+const jpegQuality = 85
+
+// Config tunes the thumbnail worker.
+type Config struct {
+	// Interval between polls for new image attachments.
+	Interval time.Duration
+	// Sizes are the longest edges, in pixels, of the thumbnails made for
+	// every image.
+	Sizes []int
+	// MaxPixels skips images with more pixels than this, which would take
+	// too much memory to decode.
+	MaxPixels int64
+	// ScanStatuses are the scan statuses of images safe to decode.
+	// ConfigFromEnv sets only clean.
+	ScanStatuses []string
+}
+
+// ConfigFromEnv reads the worker configuration from environment variables.
+func ConfigFromEnv() Config {
+	cfg := Config{Interval: 10 * time.Second, Sizes: []int{128, 512}, MaxPixels: 24_000_000, ScanStatuses: []string{models.ScanClean}}
+	if interval, err := time.ParseDuration(os.Getenv("THUMBNAIL_INTERVAL")); err == nil && interval > 0 {
+		cfg.Interval = interval
+	}
+	if value := os.Getenv("THUMBNAIL_SIZES"); value != "" {
+		var sizes []int
+		for _, item := range strings.Split(value, ",") {
+			size, err := strconv.Atoi(strings.TrimSpace(item))
+			if err != nil || size <= 0 {
+				log.Printf("Warning: invalid THUMBNAIL_SIZES %q, using %v", value, cfg.Sizes)
+				sizes = nil
+				break
+			}
+			sizes = append(sizes, size)
+		}
+		if sizes != nil {
+			cfg.Sizes = sizes
+		}
+	}
+	if pixels, err := strconv.ParseInt(os.Getenv("THUMBNAIL_MAX_PIXELS"), 10, 64); err == nil && pixels > 0 {
+		cfg.MaxPixels = pixels
+	}
+	return cfg
+}
+
+// Key returns where the thumbnail of an attachment is stored, next to the
+// todo's other objects. Each version of the attachment gets its own key, so
+// new thumbnails never collide with old ones still queued for deletion.
+func Key(attachment models.Attachment, size int, ext string) string {
+	return fmt.Sprintf("todos/%d/thumbnails/%d/v%d-%d%s", attachment.TodoID, attachment.ID, attachment.Version, size, ext)
+}
+
+// Worker generates thumbnails for image attachments in the background.
+type Worker struct {
+	db    *gorm.DB
+	store storage.Storage
+	cfg   Config
+}
+
+// NewWorker creates a worker for the attachments in db.
+func NewWorker(db *gorm.DB, store storage.Storage, cfg Config) *Worker {
+	return &Worker{db: db, store: store, cfg: cfg}
+}
+
+// Run processes new image attachments every interval until ctx is done.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := w.ProcessPending(ctx); err != nil {
+			log.Println("Thumbnail generation failed:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessPending generates thumbnails for every image attachment that has
+// not been processed yet, one batch at a time. Images the malware scanner
+// has not found clean, or that ScanStatuses does not list otherwise, are
+// never decoded. Attachments that failed are
+// retried on the next call.
+func (w *Worker) ProcessPending(ctx context.Context) error {
+	for {
+		finished, err := w.processBatch(ctx)
+		if err != nil || finished < batchSize {
+			return err
+		}
+	}
+}
+
+// processBatch claims a batch of unprocessed image attachments and
+// generates their thumbnails, returning how many it finished. The claim is
+// committed before any image is read, so no rows stay locked while the
+// worker downloads, decodes and stores. An attachment that fails only counts
+// the attempt, so it cannot hold up the rest of the batch; attachments tried
+// least often come first.
+func (w *Worker) processBatch(ctx context.Context) (int, error) {
+	attachments, err := w.claim()
+	if err != nil {
+		return 0, err
+	}
+	var finished int
+	for _, attachment := range attachments {
+		// Attachments left claimed after an error are taken over once
+		// their claim times out.
+		done, err := w.process(ctx, attachment)
+		if err != nil {
+			return finished, err
+		}
+		if done {
+			finished++
+		}
+	}
+	return finished, nil
+}
+
+// claim marks a batch of unprocessed image attachments as processing and
+// returns them. Claims older than claimTimeout are taken over, as their
+// worker probably died.
+func (w *Worker) claim() ([]models.Attachment, error) {
+	// Postgres keeps microseconds; saving compares the claim time.
+	now := time.Now().Truncate(time.Microsecond)
+	var attachments []models.Attachment
+	err := w.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("(thumbnail_status = ? OR (thumbnail_status = ? AND (thumbnail_claimed_at IS NULL OR thumbnail_claimed_at < ?)))", "", statusProcessing, now.Add(-claimTimeout)).
+			Where("scan_status IN ? AND content_type IN ?", w.cfg.ScanStatuses, Types).
+			Order("thumbnail_attempts, id").
+			Limit(batchSize).
+			Find(&attachments).Error
+		if err != nil || len(attachments) == 0 {
+			return err
+		}
+		ids := make([]uint, len(attachments))
+		for i := range attachments {
+			ids[i] = attachments[i].ID
+			attachments[i].ThumbnailStatus = statusProcessing
+			attachments[i].ThumbnailClaimedAt = &now
+		}
+		return tx.Model(&models.Attachment{}).Where("id IN ?", ids).
+			Updates(map[string]any{"thumbnail_status": statusProcessing, "thumbnail_claimed_at": now}).Error
+	})
+	return attachments, err
+}
+
+// process generates the thumbnails of a claimed attachment and saves them,
+// reporting whether the attachment is finished with. Thumbnails of an
+// attachment that was released, got new content or was taken over by
+// another worker in the meantime are discarded.
+func (w *Worker) process(ctx context.Context, attachment models.Attachment) (bool, error) {
+	thumbnails, generateErr := w.generate(ctx, attachment)
+	stored := thumbnailKeys(thumbnails)
+	// discarded collects the stored objects nothing will refer to.
+	var discarded []string
+	var finished bool
+	err := w.db.Transaction(func(tx *gorm.DB) error {
+		// The row stays locked until the thumbnails are saved, so releasing
+		// the attachment waits for them instead of missing them.
+		var current models.Attachment
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("thumbnail_status = ? AND thumbnail_claimed_at = ? AND version = ?", statusProcessing, *attachment.ThumbnailClaimedAt, attachment.Version).
+			Take(&current, attachment.ID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			discarded, finished = stored, true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if generateErr != nil && !errors.Is(generateErr, errUnusable) {
+			discarded = stored
+			attempts := current.ThumbnailAttempts + 1
+			log.Printf("Failed to make thumbnails for attachment %d (attempt %d): %v", attachment.ID, attempts, generateErr)
+			update := map[string]any{"thumbnail_attempts": attempts, "thumbnail_status": ""}
+			if attempts >= maxAttempts {
+				update["thumbnail_status"] = "failed"
+				finished = true
+			}
+			return tx.Model(&current).Updates(update).Error
+		}
+
+		status := "done"
+		if generateErr != nil {
+			log.Printf("No thumbnails for attachment %d: %v", attachment.ID, generateErr)
+			status = "failed"
+		}
+		if len(thumbnails) > 0 {
+			if err := tx.Create(&thumbnails).Error; err != nil {
+				return err
+			}
+			if err := cleanup.Cancel(tx, stored); err != nil {
+				return err
+			}
+		}
+		finished = true
+		return tx.Model(&current).Update("thumbnail_status", status).Error
+	})
+	if err != nil {
+		// Nothing was saved, so none of the objects is used.
+		discarded, finished = stored, false
+	}
+	// Their deletions were queued when they were put; they need not wait.
+	if expediteErr := cleanup.Expedite(w.db, discarded); expediteErr != nil {
+		log.Println("Failed to expedite deleting unused thumbnails:", expediteErr)
+	}
+	return finished, err
+}
+
+// thumbnailKeys returns the storage keys of thumbnails.
+func thumbnailKeys(thumbnails []models.Thumbnail) []string {
+	keys := make([]string, len(thumbnails))
+	for i, thumbnail := range thumbnails {
+		keys[i] = thumbnail.StorageKey
+	}
+	return keys
+}
+
+// generate stores a thumbnail of every configured size for attachment.
+// The objects are queued for deletion until the caller claims them. When
+// it fails, the thumbnails it returns are those already stored.
+func (w *Worker) generate(ctx context.Context, attachment models.Attachment) ([]models.Thumbnail, error) {
+	body, _, err := w.store.Get(ctx, attachment.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: object is missing", errUnusable)
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the dimensions before decoding, so a small file cannot make us
+	// allocate a huge image.
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errUnusable, err)
+	}
+	if int64(config.Width)*int64(config.Height) > w.cfg.MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d exceeds %d pixels", errUnusable, config.Width, config.Height, w.cfg.MaxPixels)
+	}
+	img, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert once; every size is scaled from the same source.
+	src := toRGBA(img)
+	var thumbnails []models.Thumbnail
+	for _, size := range w.cfg.Sizes {
+		scaled := Resize(src, size)
+		encoded, contentType, ext, err := encode(scaled)
+		if err != nil {
+			return thumbnails, err
+		}
+		key := Key(attachment, size, ext)
+		if err := cleanup.Enqueue(w.db, []string{key}, time.Now().Add(abandonAfter)); err != nil {
+			return thumbnails, err
+		}
+		err = w.store.Put(ctx, key, bytes.NewReader(encoded), storage.PutOptions{
+			ContentType: contentType,
+			Size:        int64(len(encoded)),
+		})
+		if err != nil {
+			// The put may have stored part of the object all the same.
+			return append(thumbnails, models.Thumbnail{StorageKey: key}), err
+		}
+		thumbnails = append(thumbnails, models.Thumbnail{
+			AttachmentID: attachment.ID,
+			TodoID:       attachment.TodoID,
+			Size:         size,
+			Width:        scaled.Bounds().Dx(),
+			Height:       scaled.Bounds().Dy(),
+			StorageKey:   key,
+			ContentType:  contentType,
+		})
+	}
+	return thumbnails, nil
+}
+
+// decode decodes an image, treating images the decoder chokes on, even by
+// panicking, as unusable.
+func decode(data []byte) (img image.Image, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: decoder panicked: %v", errUnusable, r)
+		}
+	}()
+	img, _, err = image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errUnusable, err)
+	}
+	return img, nil
+}
+
+// encode writes opaque images as JPEG and everything else as PNG, to keep
+// transparency.
+func encode(img *image.RGBA) ([]byte, string, string, error) {
+	var buf bytes.Buffer
+	if img.Opaque() {
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+		return buf.Bytes(), "image/jpeg", ".jpg", err
+	}
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), "image/png", ".png", err
+}
@@ -0,0 +1,98 @@
+package thumbnails
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 100))
+	for x := 0; x < 400; x++ {
+		for y := 0; y < 100; y++ {
+			// Alternate black and white columns
+			if x%2 == 0 {
+				src.Set(x, y, color.White)
+			} else {
+				src.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	scaled := Resize(src, 100)
+	assert.Equal(t, 100, scaled.Bounds().Dx())
+	assert.Equal(t, 25, scaled.Bounds().Dy())
+	// Averaging turns the stripes into grey instead of picking one of them
+	r, _, _, _ := scaled.At(10, 10).RGBA()
+	assert.InDelta(t, 0x7f7f, r, 0x200)
+
+	// Portrait images fit by their height
+	portrait := Resize(image.NewRGBA(image.Rect(0, 0, 50, 200)), 100)
+	assert.Equal(t, image.Rect(0, 0, 25, 100), portrait.Bounds())
+
+	// Small images are not scaled up, nor copied
+	smallSrc := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	small := Resize(smallSrc, 100)
+	assert.Equal(t, image.Rect(0, 0, 20, 10), small.Bounds())
+	assert.Same(t, smallSrc, small)
+
+	// Sub-images are read in place
+	cropped := Resize(src.SubImage(image.Rect(1, 0, 3, 100)).(*image.RGBA), 50)
+	assert.Equal(t, image.Rect(0, 0, 1, 50), cropped.Bounds())
+	r, _, _, _ = cropped.At(0, 0).RGBA()
+	assert.InDelta(t, 0x7f7f, r, 0x200)
+}
+
+func TestEncode(t *testing.T) {
+	opaque := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := 3; i < len(opaque.Pix); i += 4 {
+		opaque.Pix[i] = 0xff
+	}
+	data, contentType, ext, err := encode(opaque)
+	require.NoError(t, err)
+	assert.Equal(t, "image/jpeg", contentType)
+	assert.Equal(t, ".jpg", ext)
+	_, err = jpeg.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	// Transparency survives as PNG
+	data, contentType, ext, err = encode(image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", contentType)
+	assert.Equal(t, ".png", ext)
+	_, err = png.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+}
+
+func TestDecode(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2))))
+	img, err := decode(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 4, 2), img.Bounds())
+
+	// Broken images are not worth retrying
+	_, err = decode(buf.Bytes()[:buf.Len()/2])
+	assert.ErrorIs(t, err, errUnusable)
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("THUMBNAIL_INTERVAL", "1m")
+	t.Setenv("THUMBNAIL_SIZES", "64, 256")
+	t.Setenv("THUMBNAIL_MAX_PIXELS", "1000")
+
+	cfg := ConfigFromEnv()
+	assert.Equal(t, time.Minute, cfg.Interval)
+	assert.Equal(t, []int{64, 256}, cfg.Sizes)
+	assert.Equal(t, int64(1000), cfg.MaxPixels)
+
+	t.Setenv("THUMBNAIL_SIZES", "64,big")
+	assert.Equal(t, []int{128, 512}, ConfigFromEnv().Sizes)
+}
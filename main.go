@@ -1,27 +1,80 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"todo-app/internal/cleanup"
 	"todo-app/internal/database"
+	"todo-app/internal/handlers"
+	"todo-app/internal/malware"
+	"todo-app/internal/reconcile"
 	"todo-app/internal/routes"
-	"todo-app/internal/s3helper"
+	"todo-app/internal/storage"
+	"todo-app/internal/thumbnails"
 	"github.com/gin-gonic/gin"
 )
 
+// main serves the todo API, or runs the command named by the first
+// argument.
+//
+//	@title			Todo API
+//	@version		1.0
+//	@description	Todos with file attachments kept in object storage.
+//	@BasePath		/
 func main() {
 	// Initialize the database
 	database.InitDatabase()
-	s3helper.InitS3()
+
+	// Load the handler settings
+	handlers.InitSettings()
+
+	// Initialize the attachment storage backend
+	store, err := storage.New(context.Background(), storage.ConfigFromEnv())
+	if err != nil {
+		log.Fatal("Error initializing storage:", err)
+	}
+	if err := database.MigrateAttachmentKeys(context.Background(), store); err != nil {
+		log.Fatal("Error migrating attachment keys:", err)
+	}
+
+	// Initialize the malware scanner uploads are checked with
+	scanner, err := malware.New(malware.ConfigFromEnv())
+	if err != nil {
+		log.Fatal("Error initializing malware scanner:", err)
+	}
+	handlers.InitScanner(scanner)
 
 	// Get the database instance
 	db := database.GetDB()
 
+	// Run a one-off command instead of the server when one is given
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:], store, scanner)
+		return
+	}
+
+	// Delete orphaned objects queued by the handlers in the background
+	go cleanup.NewWorker(db, store, cleanup.ConfigFromEnv()).Run(context.Background())
+
+	// Generate thumbnails of image attachments in the background
+	thumbnailConfig := thumbnails.ConfigFromEnv()
+	thumbnailConfig.ScanStatuses = malware.ServableStatuses(scanner)
+	go thumbnails.NewWorker(db, store, thumbnailConfig).Run(context.Background())
+
+	// Drop resumable uploads that expired in the background
+	go handlers.ExpireUploads(context.Background(), store)
+
+	// Reconcile the bucket with the database in the background
+	go reconcile.Schedule(context.Background(), db, store, reconcile.ConfigFromEnv())
+
 	// Initialize Gin router
 	r := gin.Default()
 
 	// Register the routes
-	routes.RegisterRoutes(r, db)
+	routes.RegisterRoutes(r, db, store)
 
 	// Start the server
 	port := ":8080"
@@ -30,3 +83,57 @@ func main() {
 		log.Fatal("Error starting the server:", err)
 	}
 }
+
+func runCommand(name string, args []string, store storage.Storage, scanner malware.Scanner) {
+	switch name {
+	case "reconcile":
+		defaults := reconcile.ConfigFromEnv().Options
+		flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+		grace := flags.Duration("grace", defaults.GracePeriod, "leave orphans younger than this alone")
+		deleteOrphans := flags.Bool("delete", defaults.DeleteOrphans, "delete orphaned objects instead of only reporting them")
+		flags.Parse(args)
+
+		report, err := reconcile.Run(context.Background(), database.GetDB(), store, reconcile.Options{
+			GracePeriod:   *grace,
+			DeleteOrphans: *deleteOrphans,
+		})
+		if err != nil {
+			log.Fatal("Reconciliation failed:", err)
+		}
+		report.Print(os.Stdout)
+	case "rotate-keys":
+		encrypted, ok := store.(*storage.EncryptedStorage)
+		if !ok {
+			log.Fatal("Storage encryption is not configured")
+		}
+		rotated, err := encrypted.RotateKeys(context.Background())
+		fmt.Printf("Re-wrapped the data keys of %d objects\n", rotated)
+		if err != nil {
+			log.Fatal("Key rotation failed:", err)
+		}
+	case "scan":
+		flags := flag.NewFlagSet("scan", flag.ExitOnError)
+		all := flags.Bool("all", false, "rescan content that was scanned before, e.g. after a signature update")
+		flags.Parse(args)
+		if _, ok := scanner.(malware.Nop); ok {
+			// Nothing to scan with; make unscanned content servable
+			// instead, as content stored without a scanner is.
+			skipped, err := malware.SkipUnscanned(database.GetDB())
+			if err != nil {
+				log.Fatal("Scan failed:", err)
+			}
+			fmt.Printf("No malware scanner is configured, marked %d unscanned attachments and versions as skipped\n", skipped)
+			return
+		}
+
+		report, err := malware.Rescan(context.Background(), database.GetDB(), store, scanner, *all)
+		if report != nil {
+			report.Print(os.Stdout)
+		}
+		if err != nil {
+			log.Fatal("Scan failed:", err)
+		}
+	default:
+		log.Fatalf("Unknown command %q", name)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,8 +30,11 @@ func TestMain(m *testing.M) {
 }
 
 func TestGetTodos(t *testing.T) {
-	req := httptest.NewRequest(http.MethodGet, "/todos", nil)
+	// Newest first, as checked below
+	req := httptest.NewRequest(http.MethodGet, "/todos?sort=-id", nil)
 	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
 
 	// Seed the database with some test data
 	todo1 := models.Todo{Title: "Test Todo 1", Description: "Description 1"}
@@ -38,7 +42,7 @@ func TestGetTodos(t *testing.T) {
 	database.DB.Create(&todo1)
 	database.DB.Create(&todo2)
 
-	handlers.GetTodos(w, database.DB)
+	handlers.GetTodos(c, database.DB)
 	res := w.Result()
 
 	defer res.Body.Close()